@@ -0,0 +1,309 @@
+package vdfloc
+
+// Binary KeyValues (KV1 binary)
+//
+// Format used by Steam for appinfo.vdf, shortcuts.vdf, etc.
+// Each element starts with a type byte followed by its null terminated key:
+//	0x00 section: children follow, ended by 0x08
+//	0x01 string: null terminated utf8 value
+//	0x02 int32, 0x03 float32, 0x04 pointer (uint32), 0x06 color (uint32), 0x07 uint64, 0x0A int64:
+//	     little endian value
+//	0x08 end of the section (0x0B is accepted too)
+// A document is a list of elements ended by 0x08.
+//
+// As for text files, keys and strings are stored in the tree escaped (see Escape()) and
+// numbers are stored as text (e.g. "42", "1.5") along with their type, so that a decoded
+// tree can be written as text and is encoded back identically. Floats are written with the
+// shortest text reading back the same value, NaN with its bits (e.g. 0x7fc00001) to keep them.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValueType is the type of a value in binary KeyValues.
+type ValueType byte
+
+const (
+	ValueString  ValueType = 0x01
+	ValueInt32   ValueType = 0x02
+	ValueFloat32 ValueType = 0x03
+	ValuePointer ValueType = 0x04
+	ValueColor   ValueType = 0x06
+	ValueUint64  ValueType = 0x07
+	ValueInt64   ValueType = 0x0A
+)
+
+const (
+	binSection  = 0x00
+	binEnd      = 0x08
+	binAltEnd   = 0x0B
+	maxBinDepth = 512 // Protects against corrupted data
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case 0, ValueString:
+		return "string"
+	case ValueInt32:
+		return "int32"
+	case ValueFloat32:
+		return "float32"
+	case ValuePointer:
+		return "pointer"
+	case ValueColor:
+		return "color"
+	case ValueUint64:
+		return "uint64"
+	case ValueInt64:
+		return "int64"
+	}
+	return fmt.Sprintf("type(0x%02x)", byte(t))
+}
+
+// BinaryError reports invalid binary KeyValues data.
+type BinaryError struct {
+	Offset int64 // Offset of the problem in the data
+	Msg    string
+}
+
+func (e *BinaryError) Error() string {
+	return fmt.Sprintf("Invalid binary KeyValues at offset %d: %s", e.Offset, e.Msg)
+}
+
+type binReader struct {
+	r   *bufio.Reader
+	off int64
+}
+
+// ReadBinary()
+//
+// Decode binary KeyValues in a tree (see above).
+// err != nil (type *BinaryError) if the data is invalid or truncated.
+//
+func ReadBinary(r io.Reader) (doc *Node, err error) {
+	br := &binReader{r: bufio.NewReader(r)}
+	doc = &Node{Type: NodeDocument}
+	if err = br.children(doc, 0); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// children reads elements until the end byte. The end of the data is accepted at depth 0.
+func (br *binReader) children(parent *Node, depth int) error {
+	if depth > maxBinDepth {
+		return br.errorf("sections nested too deep")
+	}
+	for {
+		start := br.off
+		t, err := br.r.ReadByte()
+		if err == io.EOF && depth == 0 {
+			return nil
+		}
+		if err != nil {
+			return br.errorf("unexpected end of data")
+		}
+		br.off++
+
+		if t == binEnd || t == binAltEnd {
+			return nil
+		}
+
+		key, err := br.cstring()
+		if err != nil {
+			return err
+		}
+		n := &Node{Key: Escape(key)}
+		n.Span = Span{Start: Position{Offset: int(start)}}
+
+		switch ValueType(t) {
+		case binSection:
+			n.Type = NodeSection
+			if err = br.children(n, depth+1); err != nil {
+				return err
+			}
+		case ValueString:
+			n.Type, n.ValueType = NodePair, ValueString
+			if n.Value, err = br.cstring(); err != nil {
+				return err
+			}
+			n.Value = Escape(n.Value)
+		case ValueInt32, ValueFloat32, ValuePointer, ValueColor, ValueUint64, ValueInt64:
+			n.Type, n.ValueType = NodePair, ValueType(t)
+			if n.Value, err = br.number(ValueType(t)); err != nil {
+				return err
+			}
+		default:
+			return &BinaryError{Offset: start, Msg: fmt.Sprintf("unknown type 0x%02x", t)}
+		}
+		n.Span.End = Position{Offset: int(br.off)}
+		parent.add(n)
+	}
+}
+
+// cstring reads a null terminated string
+func (br *binReader) cstring() (string, error) {
+	s, err := br.r.ReadString(0)
+	if err != nil {
+		return "", br.errorf("unterminated string")
+	}
+	br.off += int64(len(s))
+	return s[:len(s)-1], nil
+}
+
+// number reads a little endian value and returns its text
+func (br *binReader) number(t ValueType) (string, error) {
+	size := 4
+	if t == ValueUint64 || t == ValueInt64 {
+		size = 8
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(br.r, b[:size]); err != nil {
+		return "", br.errorf("truncated %s value", t)
+	}
+	br.off += int64(size)
+
+	switch t {
+	case ValueInt32:
+		return strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(b[:]))), 10), nil
+	case ValueFloat32:
+		return formatFloat32(binary.LittleEndian.Uint32(b[:])), nil
+	case ValueUint64:
+		return strconv.FormatUint(binary.LittleEndian.Uint64(b[:]), 10), nil
+	case ValueInt64:
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(b[:])), 10), nil
+	default: // pointer, color
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[:])), 10), nil
+	}
+}
+
+// formatFloat32 returns the text of a float32, its bits in hexadecimal for NaN (payloads differ)
+func formatFloat32(bits uint32) string {
+	f := math.Float32frombits(bits)
+	if f != f {
+		return fmt.Sprintf("0x%08x", bits)
+	}
+	return strconv.FormatFloat(float64(f), 'g', -1, 32)
+}
+
+// parseFloat32 returns the bits of a float32 written by formatFloat32() or as a decimal number
+func parseFloat32(s string) (bits uint32, err error) {
+	if len(s) > 2 && (s[:2] == "0x" || s[:2] == "0X") && !strings.ContainsAny(s, "pP") {
+		u, err := strconv.ParseUint(s[2:], 16, 32)
+		return uint32(u), err
+	}
+	f, err := strconv.ParseFloat(s, 32)
+	return math.Float32bits(float32(f)), err
+}
+
+func (br *binReader) errorf(format string, a ...interface{}) *BinaryError {
+	return &BinaryError{Offset: br.off, Msg: fmt.Sprintf(format, a...)}
+}
+
+// WriteBinary()
+//
+// Encode the node and its descendants in binary KeyValues (see above).
+// A document is ended with 0x08. Comments, conditional statements and text formatting
+// don't exist in binary KeyValues: they are dropped. Values without type are strings.
+// Escape sequences of keys and strings are decoded, unknown ones are kept as is.
+// err != nil if a value doesn't match its type or a key/string holds a null character.
+//
+func (n *Node) WriteBinary(w io.Writer) (err error) {
+	bw := bufio.NewWriter(w)
+	if n.Type == NodeDocument {
+		for _, c := range n.Children {
+			if err = writeBinaryNode(bw, c); err != nil {
+				return err
+			}
+		}
+		bw.WriteByte(binEnd)
+	} else if err = writeBinaryNode(bw, n); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeBinaryNode(w *bufio.Writer, n *Node) (err error) {
+	switch n.Type {
+	case NodeComment, NodeDocument:
+		return nil
+	case NodeSection:
+		w.WriteByte(binSection)
+		if err = writeCString(w, n.Key); err != nil {
+			return err
+		}
+		for _, c := range n.Children {
+			if err = writeBinaryNode(w, c); err != nil {
+				return err
+			}
+		}
+		return w.WriteByte(binEnd)
+	}
+
+	t := n.ValueType
+	if t == 0 {
+		t = ValueString
+	}
+	w.WriteByte(byte(t))
+	if err = writeCString(w, n.Key); err != nil {
+		return err
+	}
+	if t == ValueString {
+		return writeCString(w, n.Value)
+	}
+
+	var b [8]byte
+	size := 4
+	switch t {
+	case ValueInt32:
+		var i int64
+		i, err = strconv.ParseInt(n.Value, 10, 32)
+		binary.LittleEndian.PutUint32(b[:], uint32(int32(i)))
+	case ValueFloat32:
+		var bits uint32
+		bits, err = parseFloat32(n.Value)
+		binary.LittleEndian.PutUint32(b[:], bits)
+	case ValuePointer, ValueColor:
+		var u uint64
+		u, err = strconv.ParseUint(n.Value, 10, 32)
+		binary.LittleEndian.PutUint32(b[:], uint32(u))
+	case ValueUint64:
+		var u uint64
+		u, err = strconv.ParseUint(n.Value, 10, 64)
+		binary.LittleEndian.PutUint64(b[:], u)
+		size = 8
+	case ValueInt64:
+		var i int64
+		i, err = strconv.ParseInt(n.Value, 10, 64)
+		binary.LittleEndian.PutUint64(b[:], uint64(i))
+		size = 8
+	default:
+		return fmt.Errorf("WriteBinary() - Key %s: unknown value type 0x%02x", n.Key, byte(t))
+	}
+	if err != nil {
+		return fmt.Errorf("WriteBinary() - Key %s: invalid %s value %q", n.Key, t, n.Value)
+	}
+	_, err = w.Write(b[:size])
+	return err
+}
+
+var errNullChar = errors.New("null character")
+
+// writeCString writes a key or string decoded and null terminated
+func writeCString(w *bufio.Writer, s string) error {
+	s, _ = Unescape(s) // Unknown escape sequences are kept
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0 {
+			return fmt.Errorf("WriteBinary() - %q: %v", s, errNullChar)
+		}
+	}
+	w.WriteString(s)
+	return w.WriteByte(0)
+}
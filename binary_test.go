@@ -0,0 +1,225 @@
+package vdfloc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// kvBin builds binary KeyValues data
+type kvBin struct{ bytes.Buffer }
+
+func (b *kvBin) elem(t byte, key string) *kvBin {
+	b.WriteByte(t)
+	b.WriteString(key)
+	b.WriteByte(0)
+	return b
+}
+
+func (b *kvBin) str(key, value string) *kvBin {
+	b.elem(0x01, key)
+	b.WriteString(value)
+	b.WriteByte(0)
+	return b
+}
+
+func (b *kvBin) u32(t byte, key string, v uint32) *kvBin {
+	b.elem(t, key)
+	binary.Write(b, binary.LittleEndian, v)
+	return b
+}
+
+func (b *kvBin) u64(t byte, key string, v uint64) *kvBin {
+	b.elem(t, key)
+	binary.Write(b, binary.LittleEndian, v)
+	return b
+}
+
+func (b *kvBin) end() *kvBin {
+	b.WriteByte(0x08)
+	return b
+}
+
+func readBinary(t *testing.T, data []byte) *Node {
+	t.Helper()
+	doc, err := ReadBinary(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadBinary(): %v", err)
+	}
+	return doc
+}
+
+func writeBinary(t *testing.T, n *Node) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := n.WriteBinary(&out); err != nil {
+		t.Fatalf("WriteBinary(): %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestBinaryAllTypes(t *testing.T) {
+	var b kvBin
+	b.elem(0x00, "root")
+	b.str("string", "a \"quoted\"\tvalue\non two lines\\")
+	b.u32(0x02, "int32", 0xfffffffb)   // -5
+	b.u32(0x03, "float32", 0x3fc00000) // 1.5
+	b.u32(0x04, "pointer", 0xdeadbeef)
+	b.u32(0x06, "color", 0xff8000ff)
+	b.u64(0x07, "uint64", 0xffffffffffffffff)
+	b.u64(0x0a, "int64", 0xffffffffffffffff) // -1
+	b.end().end()
+	data := b.Bytes()
+
+	doc := readBinary(t, data)
+	want := []struct {
+		key   string
+		typ   ValueType
+		value string
+	}{
+		{"string", ValueString, `a \"quoted\"\tvalue\non two lines\\`},
+		{"int32", ValueInt32, "-5"},
+		{"float32", ValueFloat32, "1.5"},
+		{"pointer", ValuePointer, "3735928559"},
+		{"color", ValueColor, "4286578943"},
+		{"uint64", ValueUint64, "18446744073709551615"},
+		{"int64", ValueInt64, "-1"},
+	}
+	for _, w := range want {
+		n := doc.Find("root", w.key)
+		if n == nil {
+			t.Errorf("%s not found", w.key)
+			continue
+		}
+		if n.ValueType != w.typ || n.Value != w.value {
+			t.Errorf("%s = %s %q, want %s %q", w.key, n.ValueType, n.Value, w.typ, w.value)
+		}
+	}
+
+	if out := writeBinary(t, doc); !bytes.Equal(out, data) {
+		t.Errorf("WriteBinary() =\n% x\nwant\n% x", out, data)
+	}
+}
+
+func TestBinaryAltEnd(t *testing.T) {
+	var b kvBin
+	b.elem(0x00, "s").str("k", "v")
+	b.WriteByte(0x0b) // end of section
+	b.WriteByte(0x0b) // end of document
+
+	doc := readBinary(t, b.Bytes())
+	if v, ok := doc.Get("s", "k"); !ok || v != "v" {
+		t.Fatalf("s/k = %q, %v", v, ok)
+	}
+	// Written back with the usual end byte
+	want := bytes.Replace(b.Bytes(), []byte{0x0b}, []byte{0x08}, -1)
+	if out := writeBinary(t, doc); !bytes.Equal(out, want) {
+		t.Errorf("WriteBinary() = % x, want % x", out, want)
+	}
+}
+
+func TestBinaryNestedSections(t *testing.T) {
+	var b kvBin
+	b.elem(0x00, "a")
+	b.elem(0x00, "b").elem(0x00, "c").str("deep", "1").end().end()
+	b.u32(0x02, "after", 7)
+	b.elem(0x00, "empty").end()
+	b.end()
+	b.elem(0x00, "second").str("k", "v").end()
+	b.end()
+	data := b.Bytes()
+
+	doc := readBinary(t, data)
+	if v, ok := doc.Get("a", "b", "c", "deep"); !ok || v != "1" {
+		t.Errorf("a/b/c/deep = %q, %v", v, ok)
+	}
+	if v, ok := doc.Get("a", "after"); !ok || v != "7" {
+		t.Errorf("a/after = %q, %v", v, ok)
+	}
+	if n := doc.Find("a", "empty"); n == nil || n.Type != NodeSection || len(n.Children) != 0 {
+		t.Errorf("a/empty = %+v, want an empty section", n)
+	}
+	if n := doc.Find("a", "b", "c", "deep"); n.Depth() != 3 {
+		t.Errorf("depth of deep = %d, want 3", n.Depth())
+	}
+	if out := writeBinary(t, doc); !bytes.Equal(out, data) {
+		t.Errorf("WriteBinary() =\n% x\nwant\n% x", out, data)
+	}
+}
+
+func TestBinaryFloat32Bits(t *testing.T) {
+	for _, bits := range []uint32{
+		0x00000000, // 0
+		0x80000000, // -0
+		0x00000001, // smallest subnormal
+		0x3f800001, // 1 + ulp
+		0x7f7fffff, // max
+		0x7f800000, // +Inf
+		0xff800000, // -Inf
+		0x7fc00000, // quiet NaN
+		0x7fc00001, // NaN with payload
+		0x7f800001, // signaling NaN
+		0xffffffff, // negative NaN
+	} {
+		var b kvBin
+		b.u32(0x03, "f", bits).end()
+		doc := readBinary(t, b.Bytes())
+		if out := writeBinary(t, doc); !bytes.Equal(out, b.Bytes()) {
+			t.Errorf("0x%08x (%s): WriteBinary() = % x, want % x", bits, doc.Children[0].Value, out, b.Bytes())
+		}
+	}
+
+	// Decimal text typed by hand
+	doc := &Node{Type: NodeDocument}
+	n := NewPair("f", "0.1")
+	n.ValueType = ValueFloat32
+	doc.Append(n)
+	var b kvBin
+	b.u32(0x03, "f", 0x3dcccccd).end()
+	if out := writeBinary(t, doc); !bytes.Equal(out, b.Bytes()) {
+		t.Errorf("0.1: WriteBinary() = % x, want % x", out, b.Bytes())
+	}
+}
+
+func TestBinaryErrors(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x00, 's', 0}, maxBinDepth+2)
+	tests := []struct {
+		name   string
+		data   []byte
+		offset int64
+	}{
+		{"unknown type", []byte{0x05, 'k', 0}, 0},
+		{"unknown type after a pair", append(new(kvBin).str("k", "v").Bytes(), 0x09, 'x', 0), 5},
+		{"unterminated key", []byte{0x01, 'k'}, 1},
+		{"unterminated string", []byte{0x01, 'k', 0, 'v'}, 3},
+		{"truncated int32", []byte{0x02, 'k', 0, 1, 2}, 3},
+		{"truncated uint64", []byte{0x07, 'k', 0, 1, 2, 3, 4, 5, 6, 7}, 3},
+		{"missing end of section", []byte{0x00, 's', 0, 0x01, 'k', 0, 'v', 0}, 8},
+		{"too deep", deep, int64(3 * (maxBinDepth + 1))},
+	}
+	for _, tt := range tests {
+		_, err := ReadBinary(bytes.NewReader(tt.data))
+		var be *BinaryError
+		if !errors.As(err, &be) {
+			t.Errorf("%s: err = %v, want a *BinaryError", tt.name, err)
+			continue
+		}
+		if be.Offset != tt.offset {
+			t.Errorf("%s: offset %d, want %d (%v)", tt.name, be.Offset, tt.offset, be)
+		}
+	}
+}
+
+func TestBinaryWriteErrors(t *testing.T) {
+	for _, n := range []*Node{
+		{Type: NodePair, Key: "k", Value: "x", ValueType: ValueInt32},
+		{Type: NodePair, Key: "k", Value: "4294967296", ValueType: ValueColor},
+		{Type: NodePair, Key: "k", Value: "a\x00b"},
+		{Type: NodePair, Key: "k", Value: "1", ValueType: 0x05},
+	} {
+		if err := n.WriteBinary(new(bytes.Buffer)); err == nil {
+			t.Errorf("WriteBinary(%s %q): no error", n.ValueType, n.Value)
+		}
+	}
+}
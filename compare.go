@@ -0,0 +1,233 @@
+package vdfloc
+
+// Comparison of a loc file with its english source
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// CompareEntry is a token found by CompareWithSource().
+type CompareEntry struct {
+	Key         string   `json:"key"`
+	Cond        string   `json:"cond,omitempty"`        // Conditional statement of the variant in both files (untranslated tokens)
+	Conds       []string `json:"conds,omitempty"`       // Conditional statements of the variants in the loc file, "" for none
+	SourceConds []string `json:"sourceConds,omitempty"` // Conditional statements of the variants in the english file
+	Value       string   `json:"value,omitempty"`       // Value in the loc file
+	SourceValue string   `json:"sourceValue,omitempty"` // Value in the english file
+	Span        Span     `json:"span"`                  // Location in the loc file (english file for missing tokens)
+}
+
+// CompareReport is the result of the comparison of a loc file with its english source.
+type CompareReport struct {
+	File         string         `json:"file"`         // Loc file name
+	Source       string         `json:"source"`       // English file name
+	Language     string         `json:"language"`     // Language of the loc file, empty if unknown
+	SourceKeys   int            `json:"sourceKeys"`   // Number of keys in the english file
+	Translated   int            `json:"translated"`   // Number of keys present and different from english
+	Missing      []CompareEntry `json:"missing"`      // Keys of the english file absent from the loc file
+	Extra        []CompareEntry `json:"extra"`        // Keys absent from the english file (obsolete)
+	CondDiffers  []CompareEntry `json:"condDiffers"`  // Keys whose conditional statements differ
+	Untranslated []CompareEntry `json:"untranslated"` // Values identical to english
+}
+
+// CompareWithSource()
+//
+// Compare a loc file with its english source token by token. Are reported:
+//	- missing tokens: in the english file only
+//	- extra tokens: in the loc file only (probably obsolete)
+//	- tokens with different sets of conditional statements
+//	- values identical to english (probably untranslated). Values without letters
+//	  (numbers, placeholders only, etc.) are ignored.
+// Tokens prefixed with [english] and the header are ignored.
+//
+func CompareWithSource(loc, en *VDFFile) (r *CompareReport, err error) {
+	loc.log(fmt.Sprintf("CompareWithSource(%s, %s)", loc.fileName, en.fileName))
+
+	locDoc, err := loc.tree()
+	if err != nil {
+		return nil, err
+	}
+	enDoc, err := en.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	r = &CompareReport{File: loc.fileName, Source: en.fileName,
+		Missing: []CompareEntry{}, Extra: []CompareEntry{}, CondDiffers: []CompareEntry{}, Untranslated: []CompareEntry{}} // [] rather than null in json
+	if lang, lerr := languageFromHeader(locDoc, loc.pluralGenderConfig()); lerr == nil {
+		r.Language = lang.Name
+	} else if lang, lerr := LanguageFromFileName(loc.fileName); lerr == nil {
+		r.Language = lang.Name
+	}
+
+	locKeys, locVariants := variantsByKey(locDoc)
+	enKeys, enVariants := variantsByKey(enDoc)
+	r.SourceKeys = len(enKeys)
+
+	for _, key := range enKeys {
+		if _, ok := locVariants[key]; !ok {
+			n := enVariants[key][0]
+			r.Missing = append(r.Missing, CompareEntry{Key: key, SourceConds: conds(enVariants[key]), SourceValue: n.Value, Span: n.Span})
+		}
+	}
+
+	for _, key := range locKeys {
+		lv, ev := locVariants[key], enVariants[key]
+		if ev == nil {
+			r.Extra = append(r.Extra, CompareEntry{Key: key, Conds: conds(lv), Value: lv[0].Value, Span: lv[0].Span})
+			continue
+		}
+
+		if lc, ec := conds(lv), conds(ev); strings.Join(lc, " ") != strings.Join(ec, " ") {
+			r.CondDiffers = append(r.CondDiffers, CompareEntry{Key: key, Conds: lc, SourceConds: ec, Span: lv[0].Span})
+		}
+
+		translated := true
+		for _, n := range lv {
+			for _, e := range ev {
+				if normalizedCond(n.Cond) == normalizedCond(e.Cond) && n.Value == e.Value && hasLetter(n.Value) {
+					r.Untranslated = append(r.Untranslated, CompareEntry{Key: key, Cond: n.Cond, Value: n.Value, SourceValue: e.Value, Span: n.Span})
+					translated = false
+				}
+			}
+		}
+		if translated {
+			r.Translated++
+		}
+	}
+	return r, nil
+}
+
+// OpenEnFile()
+//
+// Create an instance for the english file corresponding to a loc file on disk
+// (see GetEnFileName()), with the same options.
+//
+func (v *VDFFile) OpenEnFile() (en *VDFFile, err error) {
+	v.log(fmt.Sprintf("OpenEnFile()"))
+
+	if !v.isFile {
+		return nil, fmt.Errorf("OpenEnFile() - %s wasn't read from disk", v.pathAndName)
+	}
+	enFileName, err := v.GetEnFileName()
+	if err != nil {
+		return nil, err
+	}
+	return New(filepath.Join(filepath.Dir(v.pathAndName), enFileName), Options{
+		Logger:             v.logWriter,
+		PluralGenderConfig: v.pluralGenderConfig(),
+		KeepSourceTokens:   v.GetKeepSourceTokenFlag(),
+		MaxKeyLen:          v.ReadMaxKeyLen(),
+		AllowedTags:        v.allowedTagList(),
+	})
+}
+
+// Complete()
+//
+// Returns the percentage of english keys translated.
+//
+func (r *CompareReport) Complete() float64 {
+	if r.SourceKeys == 0 {
+		return 100
+	}
+	return float64(r.Translated) * 100 / float64(r.SourceKeys)
+}
+
+// Diagnostics()
+//
+// Returns the content of the report as diagnostics:
+// missing tokens are errors, extra tokens and conditional statement differences
+// warnings and untranslated tokens information.
+//
+func (r *CompareReport) Diagnostics() (diags Diagnostics) {
+	add := func(rule string, sev Severity, list []CompareEntry, format func(CompareEntry) string) {
+		for _, e := range list {
+			diags = append(diags, Diagnostic{Rule: rule, Severity: sev, Message: format(e), Key: e.Key, Span: e.Span})
+		}
+	}
+	add(RuleMissingToken, SeverityError, r.Missing, func(e CompareEntry) string {
+		return fmt.Sprintf("Token %s of %s is missing", e.Key, r.Source)
+	})
+	add(RuleExtraToken, SeverityWarning, r.Extra, func(e CompareEntry) string {
+		return fmt.Sprintf("Token %s is not in %s", e.Key, r.Source)
+	})
+	add(RuleCondDiffers, SeverityWarning, r.CondDiffers, func(e CompareEntry) string {
+		return fmt.Sprintf("Conditional statements of %s differ from %s: %q instead of %q", e.Key, r.Source, e.Conds, e.SourceConds)
+	})
+	add(RuleUntranslated, SeverityInfo, r.Untranslated, func(e CompareEntry) string {
+		return fmt.Sprintf("Token %s%s is identical to english", e.Key, e.Cond)
+	})
+	return diags
+}
+
+// WriteJSON()
+//
+// Write the report in json.
+//
+func (r *CompareReport) WriteJSON(w io.Writer) (err error) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(r)
+}
+
+// variantsByKey()
+//
+// Returns the keys of the tokens of a tree in document order and their variants.
+// Tokens prefixed with [english] and the header are skipped.
+//
+func variantsByKey(doc *Node) (keys []string, variants map[string][]*Node) {
+	variants = make(map[string][]*Node)
+	for _, n := range tokenPairs(doc) {
+		if _, ok := variants[n.Key]; !ok {
+			keys = append(keys, n.Key)
+		}
+		variants[n.Key] = append(variants[n.Key], n)
+	}
+	return keys, variants
+}
+
+// tokenPairs()
+//
+// Returns the pairs of the tokens section of a tree, without the header
+// language declaration and the tokens prefixed with [english].
+//
+func tokenPairs(doc *Node) (pairs []*Node) {
+	return tokenPairsKeep(doc, false)
+}
+
+// tokenPairsKeep is tokenPairs() keeping the tokens prefixed with [english] if keepSource is true
+func tokenPairsKeep(doc *Node, keepSource bool) (pairs []*Node) {
+	for _, n := range tokensSection(doc).Pairs() {
+		if (isSourceKey(n.Key) && !keepSource) || isHeaderPair(n) {
+			continue
+		}
+		pairs = append(pairs, n)
+	}
+	return pairs
+}
+
+// isHeaderPair returns true for the language declaration of the header e.g. "Language" "french"
+func isHeaderPair(n *Node) bool {
+	p := n.parent
+	return p != nil && p.parent != nil && p.parent.Type == NodeDocument && strings.EqualFold(n.Key, "Language")
+}
+
+// conds returns the sorted normalised conditional statements of the variants of a token (see normalizedCond())
+func conds(variants []*Node) (list []string) {
+	for _, n := range variants {
+		list = append(list, normalizedCond(n.Cond))
+	}
+	sort.Strings(list)
+	return list
+}
+
+// hasLetter returns true if a string holds at least a letter
+func hasLetter(s string) bool {
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
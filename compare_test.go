@@ -0,0 +1,177 @@
+package vdfloc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const compareEnglish = `"lang"
+{
+	"Language"	"english"
+	"Tokens"
+	{
+		"a"	"Hello"
+		"b"	"Bye"
+		"b"	"Bye Windows"	[$WIN32]
+		"c"	"Cancel"
+		"n"	"42"
+		"m"	"Missing"
+		"d"	"Desktop"	[$WIN32||$OSX]
+	}
+}
+`
+
+const compareFrench = `"lang"
+{
+	"Language"	"french"
+	"Tokens"
+	{
+		"[english]a"	"Hello"
+		"a"	"Bonjour"
+		"b"	"Au revoir"
+		"c"	"Cancel"
+		"n"	"42"
+		"d"	"Bureau"	[$OSX || $WIN32]
+		"old"	"Vieux"
+	}
+}
+`
+
+// entryKeys returns the keys of a list of entries
+func entryKeys(list []CompareEntry) string {
+	var keys []string
+	for _, e := range list {
+		keys = append(keys, e.Key)
+	}
+	return strings.Join(keys, " ")
+}
+
+func compare(t *testing.T, loc, en string) *CompareReport {
+	t.Helper()
+	l, _ := NewFromBytes([]byte(loc), "x_french.txt")
+	e, _ := NewFromBytes([]byte(en), "x_english.txt")
+	r, err := CompareWithSource(l, e)
+	if err != nil {
+		t.Fatalf("CompareWithSource(): %v", err)
+	}
+	return r
+}
+
+func TestCompareWithSource(t *testing.T) {
+	r := compare(t, compareFrench, compareEnglish)
+
+	if r.File != "x_french.txt" || r.Source != "x_english.txt" || r.Language != "french" {
+		t.Errorf("report of %s against %s in %s", r.File, r.Source, r.Language)
+	}
+	tests := []struct {
+		name string
+		list []CompareEntry
+		want string
+	}{
+		{"missing", r.Missing, "m"},
+		{"extra", r.Extra, "old"},
+		{"condDiffers", r.CondDiffers, "b"},   // d: same conditional statements written in another order
+		{"untranslated", r.Untranslated, "c"}, // n: no letter
+	}
+	for _, tt := range tests {
+		if got := entryKeys(tt.list); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if e := r.Missing[0]; e.SourceValue != "Missing" || e.Span.Start.File != "x_english.txt" || e.Span.Start.Line != 11 {
+		t.Errorf("missing entry = %+v", e)
+	}
+	if e := r.CondDiffers[0]; strings.Join(e.Conds, "|") != "" || strings.Join(e.SourceConds, "|") != "|[$WIN32]" {
+		t.Errorf("conds of b = %q, source %q", e.Conds, e.SourceConds)
+	}
+	if e := r.Untranslated[0]; e.Value != "Cancel" || e.SourceValue != "Cancel" || e.Span.Start.Line != 9 {
+		t.Errorf("untranslated entry = %+v", e)
+	}
+
+	// a, b, n and d out of a, b, c, n, m and d
+	if r.SourceKeys != 6 || r.Translated != 4 {
+		t.Errorf("%d translated out of %d, want 4 out of 6", r.Translated, r.SourceKeys)
+	}
+	if c := r.Complete(); c < 66.6 || c > 66.7 {
+		t.Errorf("Complete() = %v, want 66.67", c)
+	}
+}
+
+func TestCompareDiagnostics(t *testing.T) {
+	diags := compare(t, compareFrench, compareEnglish).Diagnostics()
+
+	want := []struct {
+		rule string
+		sev  Severity
+		key  string
+	}{
+		{RuleMissingToken, SeverityError, "m"},
+		{RuleExtraToken, SeverityWarning, "old"},
+		{RuleCondDiffers, SeverityWarning, "b"},
+		{RuleUntranslated, SeverityInfo, "c"},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("%d diagnostics, want %d: %v", len(diags), len(want), diags)
+	}
+	for i, w := range want {
+		if d := diags[i]; d.Rule != w.rule || d.Severity != w.sev || d.Key != w.key || len(d.Message) == 0 {
+			t.Errorf("diagnostic %d = %+v, want %s %v %s", i, d, w.rule, w.sev, w.key)
+		}
+	}
+}
+
+func TestCompareJSON(t *testing.T) {
+	// Nothing to report: empty lists rather than null
+	r := compare(t, "\"lang\" { \"Language\" \"french\" \"Tokens\" { } }", "\"lang\" { \"Tokens\" { } }")
+	if r.Complete() != 100 {
+		t.Errorf("Complete() = %v, want 100 without english keys", r.Complete())
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, buf.String())
+	}
+	for _, name := range []string{"missing", "extra", "condDiffers", "untranslated"} {
+		if l, ok := m[name].([]interface{}); !ok || len(l) != 0 {
+			t.Errorf("%s = %v, want []", name, m[name])
+		}
+	}
+	if m["language"] != "french" || m["sourceKeys"] != 0.0 {
+		t.Errorf("json = %s", buf.String())
+	}
+
+	// Entries: empty fields omitted
+	buf.Reset()
+	compare(t, compareFrench, compareEnglish).WriteJSON(&buf)
+	json.Unmarshal(buf.Bytes(), &m)
+	missing := m["missing"].([]interface{})[0].(map[string]interface{})
+	if _, ok := missing["value"]; ok || missing["key"] != "m" || missing["sourceValue"] != "Missing" {
+		t.Errorf("missing entry = %v", missing)
+	}
+}
+
+func TestCompareConcurrentSettings(t *testing.T) {
+	// Run with -race: the settings of the loc file can change during the comparison
+	l, _ := NewFromBytes([]byte(compareFrench), "x_french.txt")
+	e, _ := NewFromBytes([]byte(compareEnglish), "x_english.txt")
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			l.SetPluralGenderConfig(nil)
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := CompareWithSource(l, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,318 @@
+package vdfloc
+
+// Conditional statements
+//
+// A conditional statement restricts a token or a section to some platforms:
+//	"a_key"	"a value"	[$WIN32]
+//	"a_key"	"a value"	[!$X360]
+//	"a_key"	"a value"	[$WIN32||$OSX]
+//	"a_key"	"a value"	[$LINUX&&!$DECK]
+//
+// Grammar (! binds tighter than && which binds tighter than ||):
+//	cond    := '[' or ']'
+//	or      := and ( '||' and )*
+//	and     := unary ( '&&' unary )*
+//	unary   := '!' unary | '(' or ')' | '$' symbol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CondOp identifies the kind of a conditional expression.
+type CondOp int
+
+const (
+	CondSymbol CondOp = iota // $WIN32
+	CondNot                  // !expr
+	CondAnd                  // expr && expr ...
+	CondOr                   // expr || expr ...
+)
+
+// CondExpr is a parsed conditional statement.
+type CondExpr struct {
+	Op       CondOp
+	Symbol   string      // CondSymbol: name without $ e.g. WIN32
+	Operands []*CondExpr // CondNot: 1 operand, CondAnd/CondOr: 2 or more
+}
+
+// CondError reports a syntax error in a conditional statement.
+type CondError struct {
+	Cond   string // Conditional statement as written
+	Offset int    // Byte offset of the error in Cond
+	Msg    string
+}
+
+func (e *CondError) Error() string {
+	return fmt.Sprintf("Invalid conditional statement %s at offset %d: %s", e.Cond, e.Offset, e.Msg)
+}
+
+type condParser struct {
+	s   string
+	pos int
+}
+
+// ParseCond()
+//
+// Parse a conditional statement with or without its brackets e.g. [$WIN32||$OSX].
+// err != nil (type *CondError) in case of syntax error.
+//
+func ParseCond(cond string) (e *CondExpr, err error) {
+	p := &condParser{s: cond}
+
+	p.skipBlanks()
+	bracket := p.accept("[")
+	if e, err = p.or(); err != nil {
+		return nil, err
+	}
+	if bracket && !p.accept("]") {
+		return nil, p.errorf("missing ]")
+	}
+	if p.skipBlanks(); p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return e, nil
+}
+
+func (p *condParser) or() (e *CondExpr, err error) {
+	return p.binary(CondOr, "||", p.and)
+}
+
+func (p *condParser) and() (e *CondExpr, err error) {
+	return p.binary(CondAnd, "&&", p.unary)
+}
+
+// binary parses operands separated by an operator
+func (p *condParser) binary(op CondOp, sep string, operand func() (*CondExpr, error)) (e *CondExpr, err error) {
+	if e, err = operand(); err != nil {
+		return nil, err
+	}
+	for p.accept(sep) {
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if e.Op != op {
+			e = &CondExpr{Op: op, Operands: []*CondExpr{e}}
+		}
+		e.Operands = append(e.Operands, next)
+	}
+	return e, nil
+}
+
+func (p *condParser) unary() (e *CondExpr, err error) {
+	switch {
+	case p.accept("!"):
+		if e, err = p.unary(); err != nil {
+			return nil, err
+		}
+		return &CondExpr{Op: CondNot, Operands: []*CondExpr{e}}, nil
+	case p.accept("("):
+		if e, err = p.or(); err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf("missing )")
+		}
+		return e, nil
+	case p.accept("$"):
+		start := p.pos
+		for p.pos < len(p.s) && isSymbolChar(p.s[p.pos]) {
+			p.pos++
+		}
+		if p.pos == start {
+			return nil, p.errorf("missing symbol name after $")
+		}
+		return &CondExpr{Op: CondSymbol, Symbol: p.s[start:p.pos]}, nil
+	case p.pos == len(p.s) || p.s[p.pos] == ']':
+		return nil, p.errorf("missing symbol")
+	default:
+		return nil, p.errorf("expected $symbol, ! or ( - found %q", p.s[p.pos:p.pos+1])
+	}
+}
+
+// accept skips the blanks and then tok if it's next
+func (p *condParser) accept(tok string) bool {
+	p.skipBlanks()
+	if strings.HasPrefix(p.s[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *condParser) skipBlanks() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *condParser) errorf(format string, a ...interface{}) *CondError {
+	return &CondError{Cond: p.s, Offset: p.pos, Msg: fmt.Sprintf(format, a...)}
+}
+
+func isSymbolChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Eval()
+//
+// Evaluate the expression for a platform defining the symbols passed
+// as parameter (e.g. WIN32 or $WIN32, case insensitive).
+//
+func (e *CondExpr) Eval(platforms ...string) bool {
+	return e.eval(platformSet(platforms))
+}
+
+func (e *CondExpr) eval(defined map[string]bool) bool {
+	switch e.Op {
+	case CondSymbol:
+		return defined[strings.ToUpper(e.Symbol)]
+	case CondNot:
+		return !e.Operands[0].eval(defined)
+	case CondAnd:
+		for _, o := range e.Operands {
+			if !o.eval(defined) {
+				return false
+			}
+		}
+		return true
+	case CondOr:
+		for _, o := range e.Operands {
+			if o.eval(defined) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String returns the expression without brackets e.g. $WIN32||!$X360
+func (e *CondExpr) String() string {
+	var list []string
+	for _, o := range e.Operands {
+		s := o.String()
+		if o.Op != CondSymbol && o.Op != CondNot && o.Op != e.Op {
+			s = "(" + s + ")"
+		}
+		list = append(list, s)
+	}
+	switch e.Op {
+	case CondSymbol:
+		return "$" + e.Symbol
+	case CondNot:
+		return "!" + list[0]
+	case CondAnd:
+		return strings.Join(list, "&&")
+	default:
+		return strings.Join(list, "||")
+	}
+}
+
+// Symbols returns the symbols used by the expression, without $
+func (e *CondExpr) Symbols() (list []string) {
+	if e.Op == CondSymbol {
+		return []string{e.Symbol}
+	}
+	for _, o := range e.Operands {
+		list = append(list, o.Symbols()...)
+	}
+	return list
+}
+
+// platformSet returns the set of symbols defined, upper case without $
+func platformSet(platforms []string) map[string]bool {
+	defined := make(map[string]bool)
+	for _, p := range platforms {
+		defined[strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(p), "$"))] = true
+	}
+	return defined
+}
+
+// condActive()
+//
+// Returns true if a conditional statement (empty if none) holds for a platform.
+// An invalid statement never holds.
+//
+func condActive(cond string, defined map[string]bool) (bool, error) {
+	if len(cond) == 0 {
+		return true, nil
+	}
+	e, err := ParseCond(cond)
+	if err != nil {
+		return false, err
+	}
+	return e.eval(defined), nil
+}
+
+// Resolve()
+//
+// Returns the token map seen by the game on a platform defining the symbols passed
+// as parameters (e.g. WIN32, OSX): variants whose conditional statement doesn't hold
+// are ignored and, if several variants hold, the last one in the file wins.
+// Tokens prefixed with [english] are excluded unless SetKeepSourceTokens() was called.
+// Invalid conditional statements never hold: err lists them (type CondErrors)
+// while m is still returned.
+//
+func (v *VDFFile) Resolve(platforms ...string) (m map[string]string, err error) {
+	v.log(fmt.Sprintf("Resolve(%s)", strings.Join(platforms, ", ")))
+
+	doc, err := v.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs CondErrors
+	defined := platformSet(platforms)
+	m = make(map[string]string)
+	for _, n := range tokenPairsKeep(doc, v.GetKeepSourceTokenFlag()) {
+		active, cerr := activeInTree(n, defined)
+		if cerr != nil {
+			errs = append(errs, cerr.(*CondError))
+		}
+		if active {
+			m[n.Key] = n.Value
+		}
+	}
+	if len(errs) > 0 {
+		return m, errs
+	}
+	return m, nil
+}
+
+// activeInTree returns true if the conditional statements of a node and of its sections hold
+func activeInTree(n *Node, defined map[string]bool) (active bool, err error) {
+	for ; n != nil; n = n.parent {
+		if active, err = condActive(n.Cond, defined); !active {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// CondErrors is a list of conditional statement syntax errors.
+type CondErrors []*CondError
+
+func (l CondErrors) Error() string {
+	var msgs []string
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// CheckConditionalStatement()
+//
+// Check the syntax of the conditional statement of a token.
+// err != nil only in case of processing failure.
+//
+func (v *VDFFile) CheckConditionalStatement(t Token) (diags Diagnostics, err error) {
+	if len(t.Cond) == 0 {
+		return diags, nil
+	}
+	if _, perr := ParseCond(t.Cond); perr != nil {
+		e := perr.(*CondError)
+		diags = append(diags, newDiagnostic(RuleCondSyntax, SeverityError, t, fmt.Sprintf("Invalid conditional statement %s: %s", e.Cond, e.Msg), ""))
+	}
+	return diags, nil
+}
@@ -0,0 +1,127 @@
+package vdfloc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseCond(t *testing.T) {
+	tests := []struct {
+		cond string
+		want string // String() showing the grouping
+	}{
+		{"[$WIN32]", "$WIN32"},
+		{"$WIN32", "$WIN32"},
+		{" [ $WIN32 || $OSX ] ", "$WIN32||$OSX"},
+		{"[$A||$B||$C]", "$A||$B||$C"},
+		{"[$A&&$B||$C]", "($A&&$B)||$C"},
+		{"[$A||$B&&$C]", "$A||($B&&$C)"},
+		{"[!$A&&$B]", "!$A&&$B"},
+		{"[!$A||!$B&&$C]", "!$A||(!$B&&$C)"},
+		{"[!($A||$B)]", "!($A||$B)"},
+		{"[($A||$B)&&$C]", "($A||$B)&&$C"},
+		{"[(($A))]", "$A"},
+		{"[!!$A]", "!!$A"},
+		{"[$LINUX&&!$DECK]", "$LINUX&&!$DECK"},
+	}
+	for _, tt := range tests {
+		e, err := ParseCond(tt.cond)
+		if err != nil {
+			t.Errorf("ParseCond(%q): %v", tt.cond, err)
+			continue
+		}
+		if got := e.String(); got != tt.want {
+			t.Errorf("ParseCond(%q) = %s, want %s", tt.cond, got, tt.want)
+		}
+	}
+
+	e, _ := ParseCond("[$A||$B&&!$C]")
+	if e.Op != CondOr || len(e.Operands) != 2 || e.Operands[1].Op != CondAnd || e.Operands[1].Operands[1].Op != CondNot {
+		t.Errorf("tree of $A||$B&&!$C = %+v", e)
+	}
+	if got := strings.Join(e.Symbols(), " "); got != "A B C" {
+		t.Errorf("Symbols() = %s", got)
+	}
+}
+
+func TestParseCondErrors(t *testing.T) {
+	tests := []struct {
+		cond   string
+		offset int
+		msg    string
+	}{
+		{"", 0, "missing symbol"},
+		{"[]", 1, "missing symbol"},
+		{"[$WIN32", 7, "missing ]"},
+		{"$WIN32]", 6, `unexpected "]"`},
+		{"[$]", 2, "missing symbol name after $"},
+		{"[WIN32]", 1, `expected $symbol, ! or ( - found "W"`},
+		{"[$A&&]", 5, "missing symbol"},
+		{"[$A||&&$B]", 5, `expected $symbol, ! or ( - found "&"`},
+		{"[$A|$B]", 3, "missing ]"},
+		{"[($A||$B]", 8, "missing )"},
+		{"[$A)]", 3, "missing ]"},
+		{"[!]", 2, "missing symbol"},
+		{"[$A] $B", 5, `unexpected "$B"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseCond(tt.cond)
+		var e *CondError
+		if !errors.As(err, &e) {
+			t.Errorf("ParseCond(%q) err = %v, want a *CondError", tt.cond, err)
+			continue
+		}
+		if e.Cond != tt.cond || e.Offset != tt.offset || e.Msg != tt.msg {
+			t.Errorf("ParseCond(%q) err = %d %q, want %d %q", tt.cond, e.Offset, e.Msg, tt.offset, tt.msg)
+		}
+	}
+}
+
+func TestCondEval(t *testing.T) {
+	tests := []struct {
+		cond      string
+		platforms string // Symbols defined
+		want      bool
+	}{
+		{"[$WIN32]", "WIN32", true},
+		{"[$WIN32]", "$win32", true},
+		{"[$WIN32]", "OSX POSIX", false},
+		{"[$WIN32]", "", false},
+		{"[!$X360]", "", true},
+		{"[$WIN32||$OSX]", "OSX", true},
+		{"[$WIN32&&$OSX]", "OSX", false},
+		{"[$A||$B&&$C]", "A", true},    // $A||($B&&$C)
+		{"[($A||$B)&&$C]", "A", false}, // Parentheses
+		{"[!$A&&$B]", "B", true},       // (!$A)&&$B
+		{"[!($A&&$B)]", "B", true},     // Parentheses
+		{"[!$A&&$B]", "A B", false},    // (!$A)&&$B
+		{"[!($A||$B)]", "A", false},
+		{"[$LINUX&&!$DECK]", "LINUX POSIX", true},
+		{"[$LINUX&&!$DECK]", "LINUX POSIX DECK", false},
+	}
+	for _, tt := range tests {
+		e, err := ParseCond(tt.cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.Eval(strings.Fields(tt.platforms)...); got != tt.want {
+			t.Errorf("Eval(%s) for %q = %v, want %v", tt.cond, tt.platforms, got, tt.want)
+		}
+	}
+}
+
+func TestCheckConditionalStatement(t *testing.T) {
+	v := &VDFFile{}
+	for cond, n := range map[string]int{"": 0, "[$WIN32]": 0, "[$WIN32&&]": 1, "[WIN32]": 1} {
+		diags, err := v.CheckConditionalStatement(Token{Key: "k", Cond: cond})
+		if err != nil || len(diags) != n {
+			t.Errorf("CheckConditionalStatement(%q) = %v, %v, want %d diagnostic(s)", cond, diags, err, n)
+		}
+		for _, d := range diags {
+			if d.Rule != RuleCondSyntax || d.Severity != SeverityError || !strings.Contains(d.Message, cond) {
+				t.Errorf("diagnostic %v", d)
+			}
+		}
+	}
+}
@@ -5,14 +5,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	// "strings"
 )
 
+// ErrNoConfig is returned when plural/gender definitions are needed but none were loaded
+var ErrNoConfig = errors.New("package config - No plural/gender definitions loaded")
+
+// A Config is never modified once created: it can be shared by goroutines.
 type Config struct {
 	filename string
 	attribs  langAttributes
+	langs    map[string]language // map to simplify access to language attributes
 }
 
 	
@@ -29,10 +35,6 @@ type langAttributes struct {
 	}
 
 
-var c 	Config					// config stored in memeory
-var attribs map[string]language	// map to simplify access to language attributes
-
-
 // New()
 // Create a new instance.
 // Open the json file and load its content in memory.
@@ -47,49 +49,104 @@ func New(jsonfilename string) (*Config, error) {
 		return nil, errors.New(fmt.Sprintf("package config - Can't find file %s", jsonfilename))
 	}
 
-	c := &Config{}
-	c.filename = jsonfilename
-
 	// Try to load a json file
 	jsonFile, err := os.Open(jsonfilename)
 	if err != nil {
-		fmt.Printf("Error - problem opening %s\n%s\n", jsonfilename, err)
 		return nil, errors.New(fmt.Sprintf("package config - Can't open file %s", jsonfilename))
 	}
 	// defer the closing
 	defer jsonFile.Close()
 
+	return NewFromReader(jsonFile, jsonfilename)
+}
+
+// NewFromReader()
+// Create a new instance out of json content.
+// 	Parameter:
+//		- reader
+//		- name of the content (for error messages)
+//	Returns:
+//		- err != null in case of error
+//		- pointer to instance
+func NewFromReader(r io.Reader, name string) (*Config, error) {
+
 	// read the file in a byte slice.
-	buffer, err := ioutil.ReadAll(jsonFile)
+	buffer, err := ioutil.ReadAll(r)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("package config - Issue reading %s %v", jsonfilename, err))
+		return nil, errors.New(fmt.Sprintf("package config - Issue reading %s %v", name, err))
 	}
 
-	// fmt.Printf("file read: %s", buffer)
-	// fmt.Printf("struct: %v", c.attrib)
+	return NewFromBytes(buffer, name)
+}
+
+// NewFromBytes()
+// Create a new instance out of a buffer holding json content.
+// 	Parameter:
+//		- buffer
+//		- name of the content (for error messages)
+//	Returns:
+//		- err != null in case of error
+//		- pointer to instance
+func NewFromBytes(buffer []byte, name string) (*Config, error) {
+
+	c := &Config{}
+	c.filename = name
 
 	// Unmarshal json buffer in struct
-	err = json.Unmarshal(buffer, &c.attribs)
-	// fmt.Printf("struct: %v", c.attrib)
+	err := json.Unmarshal(buffer, &c.attribs)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("package config - Issue unmarshalling json %v", err))
+		return nil, errors.New(fmt.Sprintf("package config - Issue unmarshalling json %s %v", name, err))
 	}
 
 	// Move language attributes into a map to simplify access to data
-	attribs = make(map[string]language)
+	c.langs = make(map[string]language)
 	for _, v := range c.attribs.Languages {
-		attribs[v.Name] = v
+		c.langs[v.Name] = v
 	}
-	// fmt.Printf("c.attribs=%v\n", c.attribs)
-	// fmt.Printf("attribs=%v\n", attribs)
-	
-	if len(attribs) <= 0 {
+
+	if len(c.langs) <= 0 {
 		return nil, errors.New(fmt.Sprintf("package config - at least one language needs to be defined"))
 	}
 
 	return c, nil
 }
 
+// Overlay()
+// Create a new instance made of the languages of c, replaced or completed
+// by the languages defined in o. c and o are left unchanged.
+// 	Parameter:
+//		- config to overlay
+//	Returns:
+//		- pointer to instance
+func (c *Config) Overlay(o *Config) *Config {
+
+	n := &Config{}
+	n.langs = make(map[string]language)
+	if c != nil {
+		n.filename = c.filename
+		for _, v := range c.attribs.Languages {
+			if ov, ok := o.lang(v.Name); ok {
+				v = ov
+			}
+			n.attribs.Languages = append(n.attribs.Languages, v)
+			n.langs[v.Name] = v
+		}
+	}
+	if o != nil {
+		if len(n.filename) > 0 {
+			n.filename += "+"
+		}
+		n.filename += o.filename
+		for _, v := range o.attribs.Languages {
+			if _, ok := n.langs[v.Name]; !ok {
+				n.attribs.Languages = append(n.attribs.Languages, v)
+				n.langs[v.Name] = v
+			}
+		}
+	}
+	return n
+}
+
 // Release instance
 // Close the file and release the structure.
 func Close(c *Config) (err error) {
@@ -97,6 +154,15 @@ func Close(c *Config) (err error) {
 	return nil
 }
 
+// lang returns the attributes of a language
+func (c *Config) lang(name string) (l language, ok bool) {
+	if c == nil {
+		return l, false
+	}
+	l, ok = c.langs[name]
+	return l, ok
+}
+
 
 // GetPlural()
 //
@@ -109,9 +175,12 @@ func Close(c *Config) (err error) {
 //
 func (c *Config) GetPlural(lang string) (plurals int, err error) {
 
-	if _, ok := attribs[lang]; ok {
-		// fmt.Printf("plural= %d   \n",attribs[lang].Plural  )
-		return attribs[lang].Plural, nil
+	if c == nil {
+		return plurals, ErrNoConfig
+	}
+
+	if l, ok := c.langs[lang]; ok {
+		return l.Plural, nil
 	} else { 
 		return plurals, errors.New(fmt.Sprintf("package config - Can't find language for %s", lang))
 	}
@@ -129,12 +198,14 @@ func (c *Config) GetPlural(lang string) (plurals int, err error) {
 //
 func (c *Config) GetGenders(lang string) (genders []string, err error) {
 
-	if _, ok := attribs[lang]; ok {
-		for _, gender := range attribs[lang].Genders {
-			// fmt.Printf("gender= %v ---- ",gender.Gender  )
+	if c == nil {
+		return genders, ErrNoConfig
+	}
+
+	if l, ok := c.langs[lang]; ok {
+		for _, gender := range l.Genders {
 			genders = append(genders, gender.Gender)
 		}
-		// fmt.Printf("plural= %d   \n",attribs[lang].Plural  )
 		return genders, nil
 	} else { 
 		return genders, errors.New(fmt.Sprintf("package config - Can't find language for %s", lang))
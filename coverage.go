@@ -0,0 +1,118 @@
+package vdfloc
+
+// Conditional coverage across languages
+//
+// The variants of a token (one per conditional statement) have to be the same
+// in all the languages, otherwise some platforms display the english text
+// or no text at all.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CheckConditionalCoverage()
+//
+// Compare the conditional variants of each token of the english file with the ones
+// of the same token in the loc files:
+//	- variant of the english file missing from a loc file
+//	- variant of a loc file absent from the english file
+//	- unconditional variant in a loc file shadowing the conditional variants of the english file
+// Conditional statements are compared once normalised: [$WIN32 || $OSX] is [$OSX||$WIN32].
+// Tokens missing from a loc file are left to CompareWithSource().
+// err != nil only in case of processing failure.
+//
+func CheckConditionalCoverage(en *VDFFile, locs ...*VDFFile) (diags Diagnostics, err error) {
+	en.log(fmt.Sprintf("CheckConditionalCoverage(%s)", en.fileName))
+
+	enDoc, err := en.tree()
+	if err != nil {
+		return diags, err
+	}
+	enKeys, enVariants := variantsByKey(enDoc)
+
+	for _, loc := range locs {
+		locDoc, err := loc.tree()
+		if err != nil {
+			return diags, err
+		}
+		_, locVariants := variantsByKey(locDoc)
+
+		for _, key := range enKeys {
+			lv := locVariants[key]
+			if lv == nil {
+				continue
+			}
+			ev := enVariants[key]
+			enConds, locConds := condSet(ev), condSet(lv)
+			t := tokenFromNode(lv[0])
+
+			for _, n := range ev {
+				c := normalizedCond(n.Cond)
+				if !locConds[c] && !(len(c) > 0 && locConds[""]) {
+					msg := fmt.Sprintf("Variant %s%s of %s is missing", key, c, en.fileName)
+					diags = append(diags, newDiagnostic(RuleCondCoverage, SeverityWarning, t, msg, fmt.Sprintf("Add the variant %s.", c)))
+				}
+			}
+			for _, n := range lv {
+				c := normalizedCond(n.Cond)
+				switch {
+				case enConds[c]:
+				case len(c) == 0:
+					msg := fmt.Sprintf("Unconditional %s shadows the conditional variants %s of %s", key, strings.Join(conds(ev), " "), en.fileName)
+					diags = append(diags, newDiagnostic(RuleCondCoverage, SeverityWarning, tokenFromNode(n), msg, "Replace it with the variants of the english file."))
+				default:
+					msg := fmt.Sprintf("Variant %s%s is not in %s", key, c, en.fileName)
+					diags = append(diags, newDiagnostic(RuleCondCoverage, SeverityWarning, tokenFromNode(n), msg, ""))
+				}
+			}
+		}
+	}
+	return diags, nil
+}
+
+// condSet returns the normalised conditional statements of the variants of a token
+func condSet(variants []*Node) map[string]bool {
+	set := make(map[string]bool)
+	for _, n := range variants {
+		set[normalizedCond(n.Cond)] = true
+	}
+	return set
+}
+
+// normalizedCond returns a conditional statement without blanks nor superfluous parentheses,
+// the operands of && and || sorted e.g. [ $WIN32 || ($OSX) ] -> [$OSX||$WIN32].
+// Invalid statements are returned as is.
+func normalizedCond(cond string) string {
+	if len(cond) == 0 {
+		return cond
+	}
+	e, err := ParseCond(cond)
+	if err != nil {
+		return cond
+	}
+	return "[" + canonicalCond(e).String() + "]"
+}
+
+// canonicalCond returns a copy of an expression with the nested && (or ||) merged
+// and the operands of && and || sorted: equivalent statements written in another order
+// give the same expression
+func canonicalCond(e *CondExpr) *CondExpr {
+	if e.Op == CondSymbol {
+		return &CondExpr{Op: CondSymbol, Symbol: strings.ToUpper(e.Symbol)}
+	}
+	c := &CondExpr{Op: e.Op}
+	for _, o := range e.Operands {
+		o = canonicalCond(o)
+		if o.Op == e.Op && e.Op != CondNot { // ($A||$B)||$C -> $A||$B||$C
+			c.Operands = append(c.Operands, o.Operands...)
+		} else {
+			c.Operands = append(c.Operands, o)
+		}
+	}
+	if e.Op != CondNot {
+		sort.SliceStable(c.Operands, func(i, j int) bool { return c.Operands[i].String() < c.Operands[j].String() })
+	}
+	return c
+}
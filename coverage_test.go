@@ -0,0 +1,124 @@
+package vdfloc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizedCond(t *testing.T) {
+	tests := []struct {
+		cond string
+		want string
+	}{
+		{"", ""},
+		{"[$WIN32]", "[$WIN32]"},
+		{"[ $win32 ]", "[$WIN32]"},
+		{"[$WIN32||$OSX]", "[$OSX||$WIN32]"},
+		{"[$OSX || $WIN32]", "[$OSX||$WIN32]"},
+		{"[ $WIN32 || ($OSX) ]", "[$OSX||$WIN32]"},
+		{"[$C||($B||$A)]", "[$A||$B||$C]"},
+		{"[!$DECK&&$LINUX]", "[!$DECK&&$LINUX]"},
+		{"[$LINUX&&!$DECK]", "[!$DECK&&$LINUX]"},
+		{"[$X||$B&&$A]", "[($A&&$B)||$X]"},
+		{"[($A&&$B)||$X]", "[($A&&$B)||$X]"},
+		{"[!($OSX||$WIN32)]", "[!($OSX||$WIN32)]"},
+		{"[!($WIN32||$OSX)]", "[!($OSX||$WIN32)]"},
+		{"[$WIN32&&]", "[$WIN32&&]"}, // Invalid: as is
+	}
+	for _, tt := range tests {
+		if got := normalizedCond(tt.cond); got != tt.want {
+			t.Errorf("normalizedCond(%q) = %q, want %q", tt.cond, got, tt.want)
+		}
+	}
+}
+
+const coverageEnglish = `"lang"
+{
+	"Language"	"english"
+	"Tokens"
+	{
+		"same"	"Same"	[$WIN32||$OSX]
+		"same"	"Same"	[$LINUX]
+		"missing"	"Win"	[$WIN32]
+		"missing"	"Other"	[!$WIN32]
+		"shadow"	"Deck"	[$DECK]
+		"shadow"	"Not deck"	[!$DECK]
+		"extra"	"All"
+		"overlap"	"Posix"	[$POSIX]
+		"absent"	"Absent"
+	}
+}
+`
+
+const coverageFrench = `"lang"
+{
+	"Language"	"french"
+	"Tokens"
+	{
+		"same"	"Pareil"	[ $OSX || $WIN32 ]
+		"same"	"Pareil"	[$LINUX]
+		"missing"	"Win"	[$WIN32]
+		"shadow"	"Tout"
+		"extra"	"Tout"
+		"extra"	"Xbox"	[$X360]
+		"overlap"	"Posix"	[$POSIX]
+		"overlap"	"Linux"	[$LINUX&&$POSIX]
+	}
+}
+`
+
+func TestCheckConditionalCoverage(t *testing.T) {
+	en, _ := NewFromBytes([]byte(coverageEnglish), "x_english.txt")
+	fr, _ := NewFromBytes([]byte(coverageFrench), "x_french.txt")
+	diags, err := CheckConditionalCoverage(en, fr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		key  string
+		line int
+		msg  string
+	}{
+		{"missing", 8, "Variant missing[!$WIN32] of x_english.txt is missing"},
+		{"shadow", 9, "Unconditional shadow shadows the conditional variants [!$DECK] [$DECK] of x_english.txt"},
+		{"extra", 11, "Variant extra[$X360] is not in x_english.txt"},
+		{"overlap", 13, "Variant overlap[$LINUX&&$POSIX] is not in x_english.txt"},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("%d diagnostics, want %d:\n%v", len(diags), len(want), diags)
+	}
+	for i, w := range want {
+		d := diags[i]
+		if d.Rule != RuleCondCoverage || d.Severity != SeverityWarning || d.Key != w.key || d.Pos().Line != w.line || d.Message != w.msg {
+			t.Errorf("diagnostic %d = %v\nwant %s line %d: %s", i, d, w.key, w.line, w.msg)
+		}
+	}
+
+	// Each loc file is reported
+	diags, _ = CheckConditionalCoverage(en, fr, fr)
+	if len(diags) != 2*len(want) {
+		t.Errorf("%d diagnostics for 2 files, want %d", len(diags), 2*len(want))
+	}
+	if diags, _ = CheckConditionalCoverage(en); len(diags) != 0 {
+		t.Errorf("no loc file: %v", diags)
+	}
+}
+
+func TestCheckConditionalCoveragePlatforms(t *testing.T) {
+	// The variants missing from a loc file leave platforms without the token
+	en, _ := NewFromBytes([]byte(coverageEnglish), "x_english.txt")
+	fr, _ := NewFromBytes([]byte(coverageFrench), "x_french.txt")
+	diags, _ := CheckConditionalCoverage(en, fr)
+	var keys []string
+	for _, d := range diags {
+		if !strings.Contains(d.Message, "is missing") {
+			continue
+		}
+		keys = append(keys, d.Key)
+	}
+	undefined, _ := fr.UndefinedKeysFor("OSX", "POSIX")
+	if strings.Join(keys, " ") != "missing" || strings.Join(undefined, " ") != "missing" {
+		t.Errorf("missing variants of %v, undefined on macOS %v: want missing", keys, undefined)
+	}
+}
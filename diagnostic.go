@@ -0,0 +1,211 @@
+package vdfloc
+
+// Diagnostics returned by the checkers
+//
+// A content problem found by a checker is reported as a Diagnostic.
+// Processing failures (unreadable file, unknown language, etc.) are reported
+// as plain errors by the checkers, never as diagnostics.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Severity tells how serious a diagnostic is.
+type Severity int
+
+const (
+	SeverityInfo    Severity = iota // For information only
+	SeverityWarning                 // Probable issue, not blocking
+	SeverityError                   // Blocking issue
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// MarshalJSON serializes a severity as its name
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON reads a severity name
+func (s *Severity) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	sev, err := ParseSeverity(name)
+	if err != nil {
+		return err
+	}
+	*s = sev
+	return nil
+}
+
+// ParseSeverity()
+//
+// Returns the severity corresponding to a name (info, warning or error).
+//
+func ParseSeverity(name string) (s Severity, err error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			return Severity(i), nil
+		}
+	}
+	return s, fmt.Errorf("Unknown severity %q", name)
+}
+
+// Rule IDs
+const (
+	RuleSyntax         = "syntax"          // KeyValues syntax error
+	RuleKeyValidity    = "key-validity"    // Invalid key name
+	RuleKeyUnicity     = "key-unicity"     // Duplicate key/conditional statement
+	RuleIsolatedCond   = "isolated-cond"   // Conditional statement not following a value
+	RulePluralGender   = "plural-gender"   // Plural/gender syntax of a plural/gender token
+	RuleNonPluralGdr   = "non-plural-gdr"  // Plural/gender tags in a regular token
+	RuleHeaderLanguage = "header-language" // Declared language missing, unknown or not matching the file name
+	RuleMissingToken   = "missing-token"   // Token of the english file missing from the loc file
+	RuleExtraToken     = "extra-token"     // Token absent from the english file
+	RuleCondDiffers    = "cond-differs"    // Conditional statements different from the english file
+	RuleUntranslated   = "untranslated"    // Value identical to english
+	RulePlaceholder    = "placeholder"     // Placeholders different from the source
+	RuleMarkup         = "markup"          // Unbalanced, unknown or different markup tags
+	RuleEscape         = "escape"          // Invalid escape sequence or literal tab/line break
+	RuleCondSyntax     = "cond-syntax"     // Invalid conditional statement
+	RuleUndefinedOn    = "undefined-on"    // Token without any variant active on a platform
+	RuleCondCoverage   = "cond-coverage"   // Conditional variants different from the english file
+)
+
+// Diagnostic describes a content problem.
+type Diagnostic struct {
+	Rule     string   `json:"rule"`          // Rule ID e.g. key-unicity
+	Severity Severity `json:"severity"`      // info, warning or error
+	Message  string   `json:"message"`       // Description
+	Key      string   `json:"key,omitempty"` // Key of the token concerned if any
+	Span     Span     `json:"span"`          // Location of the problem
+	Fix      string   `json:"fix,omitempty"` // Suggested fix if any
+}
+
+// Pos returns the position of the diagnostic.
+func (d Diagnostic) Pos() Position {
+	return d.Span.Start
+}
+
+// String returns the diagnostic in the usual compiler form:
+//	czech.txt:1432:5: error: Non unique key "a_key" [key-unicity]
+func (d Diagnostic) String() string {
+	s := fmt.Sprintf("%s: %s: %s [%s]", d.Span.Start, d.Severity, d.Message, d.Rule)
+	if len(d.Fix) > 0 {
+		s += " - " + d.Fix
+	}
+	return s
+}
+
+// newDiagnostic builds a diagnostic located on a token
+func newDiagnostic(rule string, sev Severity, t Token, msg string, fix string) Diagnostic {
+	return Diagnostic{Rule: rule, Severity: sev, Message: msg, Key: t.Key, Span: t.Span, Fix: fix}
+}
+
+// Diagnostics is a list of diagnostics.
+type Diagnostics []Diagnostic
+
+// Filter()
+//
+// Returns the diagnostics for which keep returns true.
+//
+func (l Diagnostics) Filter(keep func(Diagnostic) bool) (res Diagnostics) {
+	for _, d := range l {
+		if keep(d) {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// AtLeast()
+//
+// Returns the diagnostics with a severity greater or equal to sev.
+//
+func (l Diagnostics) AtLeast(sev Severity) Diagnostics {
+	return l.Filter(func(d Diagnostic) bool { return d.Severity >= sev })
+}
+
+// ByRule()
+//
+// Returns the diagnostics of the rules passed as parameters.
+//
+func (l Diagnostics) ByRule(rules ...string) Diagnostics {
+	return l.Filter(func(d Diagnostic) bool {
+		for _, r := range rules {
+			if d.Rule == r {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// HasErrors returns true if at least one diagnostic is blocking.
+func (l Diagnostics) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity >= SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort()
+//
+// Sort the diagnostics in place by file, line, column and rule.
+//
+func (l Diagnostics) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i].Span.Start, l[j].Span.Start
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return l[i].Rule < l[j].Rule
+	})
+}
+
+// WriteText()
+//
+// Write the diagnostics one per line (see Diagnostic.String()).
+//
+func (l Diagnostics) WriteText(w io.Writer) (err error) {
+	for _, d := range l {
+		if _, err = fmt.Fprintln(w, d.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON()
+//
+// Write the diagnostics as a json array.
+//
+func (l Diagnostics) WriteJSON(w io.Writer) (err error) {
+	if l == nil {
+		l = Diagnostics{} // [] rather than null
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(l)
+}
@@ -0,0 +1,170 @@
+package vdfloc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// diag returns a diagnostic located at file:line:column
+func diag(rule string, sev Severity, file string, line, column int) Diagnostic {
+	return Diagnostic{Rule: rule, Severity: sev, Message: rule, Span: Span{Start: Position{File: file, Line: line, Column: column}}}
+}
+
+// diagRules returns the rules of a list of diagnostics
+func diagRules(l Diagnostics) string {
+	var rules []string
+	for _, d := range l {
+		rules = append(rules, d.Rule)
+	}
+	return strings.Join(rules, " ")
+}
+
+func TestDiagnosticsFilter(t *testing.T) {
+	l := Diagnostics{
+		diag("i", SeverityInfo, "a.txt", 1, 1),
+		diag("w", SeverityWarning, "a.txt", 2, 1),
+		diag("e", SeverityError, "a.txt", 3, 1),
+		diag("w2", SeverityWarning, "a.txt", 4, 1),
+	}
+	tests := []struct {
+		name string
+		got  Diagnostics
+		want string
+	}{
+		{"AtLeast(info)", l.AtLeast(SeverityInfo), "i w e w2"},
+		{"AtLeast(warning)", l.AtLeast(SeverityWarning), "w e w2"},
+		{"AtLeast(error)", l.AtLeast(SeverityError), "e"},
+		{"ByRule(w, e)", l.ByRule("w", "e"), "w e"},
+		{"ByRule()", l.ByRule(), ""},
+		{"Filter(line > 2)", l.Filter(func(d Diagnostic) bool { return d.Pos().Line > 2 }), "e w2"},
+	}
+	for _, tt := range tests {
+		if got := diagRules(tt.got); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if !l.HasErrors() || l.AtLeast(SeverityError).ByRule("w").HasErrors() || Diagnostics(nil).HasErrors() {
+		t.Errorf("HasErrors() wrong")
+	}
+}
+
+func TestDiagnosticsSort(t *testing.T) {
+	l := Diagnostics{
+		diag("b2", SeverityInfo, "b.txt", 1, 1),
+		diag("a10", SeverityInfo, "a.txt", 10, 1),
+		diag("a2-9", SeverityInfo, "a.txt", 2, 9),
+		diag("a2-10", SeverityInfo, "a.txt", 2, 10),
+		diag("z", SeverityInfo, "a.txt", 1, 5),
+		diag("y", SeverityInfo, "a.txt", 1, 5),  // Same position: by rule
+		diag("y", SeverityError, "a.txt", 1, 5), // Same rule: order kept
+	}
+	l.Sort()
+	if got := diagRules(l); got != "y y z a2-9 a2-10 a10 b2" {
+		t.Errorf("Sort() = %s", got)
+	}
+	if l[0].Severity != SeverityInfo || l[1].Severity != SeverityError {
+		t.Errorf("Sort() isn't stable")
+	}
+}
+
+func TestDiagnosticsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Diagnostics(nil).WriteJSON(&buf); err != nil || strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("WriteJSON() of no diagnostic = %q, %v", buf.String(), err)
+	}
+
+	d := diag(RuleKeyUnicity, SeverityWarning, "x.txt", 3, 5)
+	d.Span.Start.Offset, d.Span.End = 20, Position{File: "x.txt", Line: 3, Column: 8, Offset: 23}
+	l := Diagnostics{d, {Rule: RuleSyntax, Severity: SeverityError, Message: "m", Key: "k", Fix: "f"}}
+	buf.Reset()
+	if err := l.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var raw []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"message":"key-unicity","rule":"key-unicity","severity":"warning","span":{"end":{"column":8,"file":"x.txt","line":3,"offset":23},"start":{"column":5,"file":"x.txt","line":3,"offset":20}}}`
+	if got, _ := json.Marshal(raw[0]); string(got) != want { // Empty key and fix omitted
+		t.Errorf("json = %s\nwant %s", got, want)
+	}
+	if raw[1]["key"] != "k" || raw[1]["fix"] != "f" || raw[1]["severity"] != "error" {
+		t.Errorf("json = %v", raw[1])
+	}
+
+	var back Diagnostics
+	if err := json.Unmarshal(buf.Bytes(), &back); err != nil {
+		t.Fatal(err)
+	}
+	if len(back) != 2 || back[0] != l[0] || back[1] != l[1] {
+		t.Errorf("read back %+v, want %+v", back, l)
+	}
+	if err := json.Unmarshal([]byte(`[{"severity":"fatal"}]`), &back); err == nil {
+		t.Error("unknown severity: no error")
+	}
+}
+
+func TestDiagnosticText(t *testing.T) {
+	tests := []struct {
+		pos  Position
+		want string
+	}{
+		{Position{File: "czech.txt", Line: 1432, Column: 5}, "czech.txt:1432:5"},
+		{Position{Line: 3, Column: 2}, "3:2"},
+		{Position{File: "czech.txt", Line: 3}, "czech.txt:3"},
+		{Position{File: "czech.txt"}, "czech.txt"},
+		{Position{}, "-"},
+	}
+	for _, tt := range tests {
+		if got := tt.pos.String(); got != tt.want {
+			t.Errorf("%+v: String() = %q, want %q", tt.pos, got, tt.want)
+		}
+		if got := (Span{Start: tt.pos}).String(); got != tt.want {
+			t.Errorf("%+v: Span.String() = %q, want %q", tt.pos, got, tt.want)
+		}
+	}
+
+	d := diag(RuleKeyUnicity, SeverityError, "czech.txt", 1432, 5)
+	d.Message, d.Fix = `Non unique key "a_key"`, "Rename it"
+	var buf bytes.Buffer
+	Diagnostics{d}.WriteText(&buf)
+	if want := "czech.txt:1432:5: error: Non unique key \"a_key\" [key-unicity] - Rename it\n"; buf.String() != want {
+		t.Errorf("WriteText() = %q, want %q", buf.String(), want)
+	}
+
+	for _, name := range []string{"info", "Warning", "ERROR"} {
+		if s, err := ParseSeverity(name); err != nil || !strings.EqualFold(s.String(), name) {
+			t.Errorf("ParseSeverity(%s) = %v, %v", name, s, err)
+		}
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Error("ParseSeverity(fatal): no error")
+	}
+	if s := Severity(7).String(); s != "severity(7)" {
+		t.Errorf("String() = %s", s)
+	}
+}
+
+func TestPositionColumns(t *testing.T) {
+	// Columns count characters, offsets bytes; CR LF is one line break
+	doc, _ := ParseFile("x.txt", []byte("\"é\"\t\"à\"\t\"k\"\t\"v\"\r\n\"k2\"\t\"v2\""))
+	pairs := doc.Pairs()
+	tests := []struct {
+		pos  Position
+		want string
+		off  int
+	}{
+		{pairs[0].Span.Start, "x.txt:1:1", 0},
+		{pairs[0].Span.End, "x.txt:1:8", 9},
+		{pairs[1].Span.Start, "x.txt:1:9", 10},
+		{pairs[2].Span.Start, "x.txt:2:1", 19},
+	}
+	for _, tt := range tests {
+		if tt.pos.String() != tt.want || tt.pos.Offset != tt.off {
+			t.Errorf("position %s (offset %d), want %s (offset %d)", tt.pos, tt.pos.Offset, tt.want, tt.off)
+		}
+	}
+}
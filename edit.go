@@ -0,0 +1,298 @@
+package vdfloc
+
+// Programmatic editing of loc files
+//
+// Edits apply to the tree of the instance (see GetTree()) and only touch
+// the affected lines when the file is saved.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Set()
+//
+// Set the value of the unconditional variant of a token.
+// The token is added at the end of the tokens section if it doesn't exist.
+// The value is written as is: escape sequences have to be present already.
+//
+func (v *VDFFile) Set(key, value string) (err error) {
+	v.log(fmt.Sprintf("Set(%s)", key))
+	return v.set(key, "", value)
+}
+
+// SetConditional()
+//
+// Set the value of the variant of a token matching a conditional statement
+// (e.g. [$WIN32] or $WIN32). A new variant is added after the existing ones if any,
+// at the end of the tokens section otherwise.
+//
+func (v *VDFFile) SetConditional(key, cond, value string) (err error) {
+	v.log(fmt.Sprintf("SetConditional(%s, %s)", key, cond))
+	return v.set(key, normalizeCond(cond), value)
+}
+
+func (v *VDFFile) set(key, cond, value string) (err error) {
+	doc, err := v.tree()
+	if err != nil {
+		return err
+	}
+
+	variants := findPairs(doc, key)
+	for _, n := range variants {
+		if n.Cond == cond {
+			n.Value = value
+			return nil
+		}
+	}
+
+	n := NewPair(key, value)
+	n.Cond = cond
+	if len(variants) > 0 { // Keep the variants of a token together
+		last := variants[len(variants)-1]
+		last.parent.Insert(last.parent.IndexOf(last)+1, n)
+	} else {
+		tokensSection(doc).Append(n)
+	}
+	return nil
+}
+
+// Delete()
+//
+// Remove all the variants of a token (conditional or not).
+// err != nil if the token doesn't exist.
+//
+func (v *VDFFile) Delete(key string) (err error) {
+	v.log(fmt.Sprintf("Delete(%s)", key))
+
+	doc, err := v.tree()
+	if err != nil {
+		return err
+	}
+
+	variants := findPairs(doc, key)
+	if len(variants) == 0 {
+		return fmt.Errorf("Delete() - Token %s not found", key)
+	}
+	for _, n := range variants {
+		n.parent.Remove(n)
+	}
+	return nil
+}
+
+// Rename()
+//
+// Rename all the variants of a token along with its [english] source token if any.
+// err != nil if the token doesn't exist or if the new name is already used,
+// [english] source token included.
+//
+func (v *VDFFile) Rename(oldKey, newKey string) (err error) {
+	v.log(fmt.Sprintf("Rename(%s, %s)", oldKey, newKey))
+
+	doc, err := v.tree()
+	if err != nil {
+		return err
+	}
+
+	variants := findPairs(doc, oldKey)
+	if len(variants) == 0 {
+		return fmt.Errorf("Rename() - Token %s not found", oldKey)
+	}
+	if oldKey == newKey {
+		return nil
+	}
+	for _, key := range []string{newKey, "[english]" + newKey} {
+		if len(findPairs(doc, key)) > 0 {
+			return fmt.Errorf("Rename() - Token %s already exists", key)
+		}
+	}
+
+	for _, n := range variants {
+		n.Key = newKey
+	}
+	for _, n := range findPairs(doc, "[english]"+oldKey) {
+		n.Key = "[english]" + newKey
+	}
+	return nil
+}
+
+// InsertAfter()
+//
+// Insert tokens (key, value, conditional statement and comment are used) after
+// the last variant of the anchor token, in the order they are passed.
+// err != nil if the anchor doesn't exist or if one of the tokens exists already.
+//
+func (v *VDFFile) InsertAfter(anchorKey string, tokens ...Token) (err error) {
+	v.log(fmt.Sprintf("InsertAfter(%s)", anchorKey))
+
+	doc, err := v.tree()
+	if err != nil {
+		return err
+	}
+
+	anchors := findPairs(doc, anchorKey)
+	if len(anchors) == 0 {
+		return fmt.Errorf("InsertAfter() - Token %s not found", anchorKey)
+	}
+
+	// Check all tokens first so that nothing is inserted on error
+	for _, t := range tokens {
+		for _, n := range findPairs(doc, t.Key) {
+			if n.Cond == normalizeCond(t.Cond) {
+				return fmt.Errorf("InsertAfter() - Token %s%s already exists", t.Key, n.Cond)
+			}
+		}
+	}
+
+	anchor := anchors[len(anchors)-1]
+	idx := anchor.parent.IndexOf(anchor)
+	for i, t := range tokens {
+		n := NewPair(t.Key, t.Value)
+		n.Cond = normalizeCond(t.Cond)
+		n.Comment = formatComment(t.Comment)
+		anchor.parent.Insert(idx+1+i, n)
+	}
+	return nil
+}
+
+// Save()
+//
+// Write the file back in its original encoding (see GetEncoding()).
+// Lines that weren't modified are written exactly as read.
+//
+func (v *VDFFile) Save() (err error) {
+	v.log(fmt.Sprintf("Save() - %s", v.pathAndName))
+
+	if !v.isFile {
+		return fmt.Errorf("Save() - %s wasn't read from disk, use SaveAs() or Write()", v.pathAndName)
+	}
+	if _, err = v.tree(); err != nil { // The encoding is known once the file is read
+		return err
+	}
+	return v.save(v.pathAndName, v.encodingName())
+}
+
+// SaveAs()
+//
+// Write the file under a new name and/or encoding (UTF8, UTF8BOM, UTF16LE, UTF16BE,
+// UTF32LE, UTF32BE or empty to keep the current one).
+// The instance then refers to the new file.
+//
+func (v *VDFFile) SaveAs(path string, encoding string) (err error) {
+	v.log(fmt.Sprintf("SaveAs(%s, %s)", path, encoding))
+
+	if len(path) == 0 {
+		return fmt.Errorf("SaveAs() - File name cannot be empty")
+	}
+	if len(encoding) == 0 {
+		if _, err = v.tree(); err != nil {
+			return err
+		}
+		encoding = v.encodingName()
+	}
+	if err = checkEncodingName(encoding); err != nil {
+		return fmt.Errorf("SaveAs() - %v", err)
+	}
+
+	if err = v.save(path, encoding); err != nil {
+		return err
+	}
+
+	v.pathAndName = path
+	v.fileName = filepath.Base(path)
+	v.setEncoding(encoding)
+	v.open = func() (io.ReadCloser, error) { return os.Open(path) }
+	v.isFile = true
+	v.fsys, v.fsName = os.DirFS(filepath.Dir(path)), filepath.Base(path)
+	return nil
+}
+
+// save()
+//
+// Write the tree in a temporary file then replace the destination
+// so that the destination is left untouched on failure.
+//
+func (v *VDFFile) save(path string, encoding string) (err error) {
+	doc, err := v.tree()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("Unable to create file %s - %v", tmp, err)
+	}
+	if fi, serr := os.Stat(path); serr == nil { // Keep the permissions of the file replaced
+		err = f.Chmod(fi.Mode().Perm())
+	}
+
+	var u *UTF8Enc
+	if err == nil {
+		u, err = NewUTFWriter(f, encoding)
+	}
+	if err == nil {
+		_, err = doc.WriteTo(u)
+	}
+	if err == nil {
+		err = u.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Unable to write file %s - %v", path, err)
+	}
+
+	if v.f != nil && path == v.pathAndName { // Some OSes don't replace an open file
+		v.f.Close()
+		v.f = nil
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Unable to replace file %s - %v", path, err)
+	}
+	return nil
+}
+
+// findPairs returns all the pairs of the tokens section with a given key in document order, header excluded
+func findPairs(doc *Node, key string) (list []*Node) {
+	for _, n := range tokensSection(doc).Pairs() {
+		if n.Key == key && !isHeaderPair(n) {
+			list = append(list, n)
+		}
+	}
+	return list
+}
+
+// tokensSection()
+//
+// Returns the section holding the tokens: the first one named Tokens,
+// or else the last section opened, or else the document itself.
+//
+func tokensSection(doc *Node) *Node {
+	var last *Node
+	for _, s := range doc.Sections() {
+		if strings.EqualFold(s.Key, "Tokens") {
+			return s
+		}
+		last = s
+	}
+	if last != nil {
+		return last
+	}
+	return doc
+}
+
+// normalizeCond makes sure a non empty conditional statement is surrounded with brackets
+func normalizeCond(cond string) string {
+	cond = strings.TrimSpace(cond)
+	if len(cond) > 0 && !strings.HasPrefix(cond, "[") {
+		cond = "[" + cond + "]"
+	}
+	return cond
+}
@@ -0,0 +1,181 @@
+package vdfloc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const editFile = "\"lang\"\n{\n\t\"Language\"\t\"french\"\n\t\"Tokens\"\n\t{\n" +
+	"\t\t\"a\"\t\"A\"\n" +
+	"\t\t\"b\"\t\"B\"\n" +
+	"\t\t\"b\"\t\"B win\"\t[$WIN32]\n" +
+	"\t\t\"[english]c\"\t\"C en\"\n" +
+	"\t\t\"c\"\t\"C\"\n" +
+	"\t\t\"[english]g\"\t\"G en\"\n" +
+	"\t}\n}\n"
+
+func TestEdit(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(v *VDFFile) error
+		old  string // Replaced in editFile to get the expected result, unchanged on error
+		new  string
+		err  bool
+	}{
+		{"set", func(v *VDFFile) error { return v.Set("a", "A2") },
+			"\"a\"\t\"A\"", "\"a\"\t\"A2\"", false},
+		{"set new", func(v *VDFFile) error { return v.Set("d", "D") },
+			"\"G en\"\n", "\"G en\"\n\t\t\"d\"\t\"D\"\n", false},
+		{"set header key", func(v *VDFFile) error { return v.Set("Language", "x") },
+			"\"G en\"\n", "\"G en\"\n\t\t\"Language\"\t\"x\"\n", false},
+		{"set conditional", func(v *VDFFile) error { return v.SetConditional("b", "$WIN32", "B w") },
+			"\"B win\"", "\"B w\"", false},
+		{"set new conditional", func(v *VDFFile) error { return v.SetConditional("b", "[$OSX]", "B osx") },
+			"[$WIN32]\n", "[$WIN32]\n\t\t\"b\"\t\"B osx\"\t[$OSX]\n", false},
+		{"delete", func(v *VDFFile) error { return v.Delete("b") },
+			"\t\t\"b\"\t\"B\"\n\t\t\"b\"\t\"B win\"\t[$WIN32]\n", "", false},
+		{"delete unknown", func(v *VDFFile) error { return v.Delete("x") }, "", "", true},
+		{"delete header", func(v *VDFFile) error { return v.Delete("Language") }, "", "", true},
+		{"rename", func(v *VDFFile) error { return v.Rename("b", "e") },
+			"\"b\"\t\"B\"\n\t\t\"b\"", "\"e\"\t\"B\"\n\t\t\"e\"", false},
+		{"rename unknown", func(v *VDFFile) error { return v.Rename("x", "y") }, "", "", true},
+		{"rename to existing", func(v *VDFFile) error { return v.Rename("a", "c") }, "", "", true},
+		{"rename with source", func(v *VDFFile) error { return v.Rename("c", "f") },
+			"\"[english]c\"\t\"C en\"\n\t\t\"c\"", "\"[english]f\"\t\"C en\"\n\t\t\"f\"", false},
+		{"rename to existing source", func(v *VDFFile) error { return v.Rename("a", "g") }, "", "", true},
+		{"insert after", func(v *VDFFile) error {
+			return v.InsertAfter("a", Token{Key: "a2", Value: "A2", Cond: "$OSX", Comment: "new"}, Token{Key: "a3", Value: "A3"})
+		}, "\"A\"\n", "\"A\"\n\t\t\"a2\"\t\"A2\"\t[$OSX]\t// new\n\t\t\"a3\"\t\"A3\"\n", false},
+		{"insert after last variant", func(v *VDFFile) error { return v.InsertAfter("b", Token{Key: "b2", Value: "B2"}) },
+			"[$WIN32]\n", "[$WIN32]\n\t\t\"b2\"\t\"B2\"\n", false},
+		{"insert after unknown", func(v *VDFFile) error { return v.InsertAfter("x", Token{Key: "y", Value: "Y"}) }, "", "", true},
+		{"insert existing", func(v *VDFFile) error {
+			return v.InsertAfter("a", Token{Key: "a2", Value: "A2"}, Token{Key: "b", Value: "B", Cond: "$WIN32"})
+		}, "", "", true},
+	}
+	for _, tt := range tests {
+		v, _ := NewFromBytes([]byte(editFile), "x_french.txt")
+		err := tt.edit(v)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: err = %v", tt.name, err)
+			continue
+		}
+		var out bytes.Buffer
+		if err := v.Write(&out); err != nil {
+			t.Fatalf("%s: Write(): %v", tt.name, err)
+		}
+		want := strings.Replace(editFile, tt.old, tt.new, 1)
+		if out.String() != want {
+			t.Errorf("%s: Write() =\n%s\nwant\n%s", tt.name, out.String(), want)
+		}
+	}
+}
+
+func TestEditChangesOneLine(t *testing.T) {
+	for _, nl := range []string{"\n", "\r\n"} {
+		src := strings.Replace(writerFile, "\n", nl, -1)
+		v, _ := NewFromBytes([]byte(src), "x_french.txt")
+		if err := v.Set("b", "B modifié"); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.SetConditional("a", "$WIN32", "A \\\"2\\\""); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := v.Write(&out); err != nil {
+			t.Fatal(err)
+		}
+		diff := diffLines(t, src, out.String())
+		want := []string{"\t\t\"a\"\t\"A \\\"2\\\"\"\t[$WIN32]\t// comment" + strings.TrimSuffix(nl, "\n"), "\t\t\"b\"  \"B modifié\"" + strings.TrimSuffix(nl, "\n")}
+		if strings.Join(diff, "|") != strings.Join(want, "|") {
+			t.Errorf("%q: changed lines %q, want %q", nl, diff, want)
+		}
+	}
+}
+
+func TestSaveKeepsEncoding(t *testing.T) {
+	for _, enc := range []string{"UTF8BOM", "UTF16LE", "UTF16BE"} {
+		path := filepath.Join(t.TempDir(), "x_french.txt")
+		src := encode(t, strings.Replace(editFile, "\n", "\r\n", -1), enc)
+		if err := ioutil.WriteFile(path, src, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		v, err := New(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = v.Save(); err != nil { // Saved straight away
+			t.Fatalf("%s: Save(): %v", enc, err)
+		}
+		Close(v)
+		got, _ := ioutil.ReadFile(path)
+		if !bytes.Equal(got, src) {
+			t.Errorf("%s: Save() wrote % x...\nwant % x...", enc, got[:8], src[:8])
+		}
+		if fi, _ := os.Stat(path); runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+			t.Errorf("%s: permissions %v, want 0600", enc, fi.Mode().Perm())
+		}
+	}
+}
+
+func TestSaveAs(t *testing.T) {
+	dir := t.TempDir()
+	v, _ := NewFromBytes([]byte(editFile), "x_french.txt")
+	if err := v.Save(); err == nil {
+		t.Error("Save() of a buffer: no error")
+	}
+	if err := v.SaveAs("", ""); err == nil {
+		t.Error("SaveAs() without name: no error")
+	}
+	if err := v.SaveAs(filepath.Join(dir, "bad.txt"), "UTF7"); err == nil {
+		t.Error("SaveAs() in an unknown encoding: no error")
+	}
+
+	path := filepath.Join(dir, "y_french.txt")
+	if err := v.SaveAs(path, "UTF16LE"); err != nil {
+		t.Fatalf("SaveAs(): %v", err)
+	}
+	if got, want := encode(t, editFile, "UTF16LE"), readFile(t, path); !bytes.Equal(got, want) {
+		t.Errorf("SaveAs() wrote % x, want % x", got, want)
+	}
+	if v.GetEncoding() != "UTF16LE" || v.fileName != "y_french.txt" {
+		t.Errorf("instance refers to %s in %s", v.fileName, v.GetEncoding())
+	}
+
+	// The instance now refers to the new file
+	v.Set("a", "A2")
+	if err := v.Save(); err != nil {
+		t.Fatalf("Save(): %v", err)
+	}
+	want := encode(t, strings.Replace(editFile, "\"A\"", "\"A2\"", 1), "UTF16LE")
+	if got := readFile(t, path); !bytes.Equal(got, want) {
+		t.Errorf("Save() after SaveAs() wrote % x, want % x", got, want)
+	}
+
+	// Empty encoding: keep the one of the file
+	other := filepath.Join(dir, "z_french.txt")
+	if err := v.SaveAs(other, ""); err != nil {
+		t.Fatalf("SaveAs(): %v", err)
+	}
+	if got := readFile(t, other); !bytes.Equal(got, want) {
+		t.Errorf("SaveAs() in the same encoding wrote % x, want % x", got, want)
+	}
+	if _, err := os.Stat(other + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
@@ -0,0 +1,128 @@
+package vdfloc
+
+// KeyValues escape sequences
+//
+// Keys and values are stored as written in the file. The escape sequences
+// supported in loc files are \n (line break), \t (tab), \\ and \".
+
+import (
+	"fmt"
+	"strings"
+)
+
+var unescapes = map[byte]byte{'n': '\n', 't': '\t', '\\': '\\', '"': '"'}
+
+var escaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t")
+
+// Unescape()
+//
+// Decode the escape sequences of a key or value as written in a file.
+// Unknown escape sequences are kept as is and reported by err along with
+// a trailing backslash.
+//
+func Unescape(s string) (res string, err error) {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 == len(s) {
+			b.WriteByte(c)
+			if err == nil {
+				err = fmt.Errorf("Trailing backslash at offset %d", i)
+			}
+			break
+		}
+		if d, ok := unescapes[s[i+1]]; ok {
+			b.WriteByte(d)
+		} else {
+			b.WriteString(s[i : i+2])
+			if err == nil {
+				err = fmt.Errorf("Unknown escape sequence \\%c at offset %d", s[i+1], i)
+			}
+		}
+		i++
+	}
+	return b.String(), err
+}
+
+// Escape()
+//
+// Encode a text so that it can be written as a key or value:
+// backslashes, double quotes, line breaks and tabs are escaped.
+//
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// CheckEscapes()
+//
+// Check the escape sequences of a token value:
+//	- unknown escape sequences e.g. \x (error)
+//	- backslash escaping the closing quote, the value then runs on the next lines (error)
+//	- literal tabs and line breaks where \t and \n are expected (warning)
+// err != nil only in case of processing failure.
+//
+func (v *VDFFile) CheckEscapes(t Token) (diags Diagnostics, err error) {
+	// v.log(fmt.Sprintf("CheckEscapes(%s, %s)", t.Key, t.Value)) remove log out of concerns about performance impact
+
+	s := t.Value
+	add := func(sev Severity, start, end int, msg, fix string) {
+		d := newDiagnostic(RuleEscape, sev, t, msg, fix)
+		d.Span = t.valueSpan(start, end)
+		diags = append(diags, d)
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				add(SeverityError, i, i+1, "Trailing backslash", "Double the backslash.")
+				continue
+			}
+			next := s[i+1]
+			switch {
+			case next == '"' && danglingQuote(s[i+2:]):
+				add(SeverityError, i, i+2, "Backslash before the closing quote: the value runs on the next line", "Remove the backslash or double it.")
+				return diags, nil // The rest of the value is the next lines of the file
+			case unescapes[next] == 0:
+				add(SeverityError, i, i+2, fmt.Sprintf("Unknown escape sequence \\%c", next), "Double the backslash if it's not an escape sequence.")
+			}
+			i++
+		case '\t':
+			add(SeverityWarning, i, i+1, "Literal tab in value", "Replace it with \\t.")
+		case '\n':
+			add(SeverityWarning, i, i+1, "Literal line break in value", "Replace it with \\n.")
+		}
+	}
+	return diags, nil
+}
+
+// danglingQuote returns true if an escaped quote is followed by the end of the line
+func danglingQuote(rest string) bool {
+	rest = strings.TrimLeft(rest, " \t\r")
+	return strings.HasPrefix(rest, "\n")
+}
+
+// DecodedValue()
+//
+// Returns the value of a pair with its escape sequences decoded (see Unescape()).
+//
+func (n *Node) DecodedValue() (string, error) {
+	return Unescape(n.Value)
+}
+
+// SetDecodedValue()
+//
+// Set the value of a pair from a text which is escaped (see Escape()).
+//
+func (n *Node) SetDecodedValue(text string) {
+	n.Value = Escape(text)
+}
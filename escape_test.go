@@ -0,0 +1,119 @@
+package vdfloc
+
+import (
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestEscapeRoundTrip(t *testing.T) {
+	texts := []string{
+		"",
+		"plain",
+		`say "hi"`,
+		"line 1\nline 2\ttab",
+		`C:\dir\new`, // \n to keep as is
+		`\`,
+		`\\"`,
+		"\r\n",
+		"été ☃",
+	}
+	for _, s := range texts {
+		got, err := Unescape(Escape(s))
+		if err != nil || got != s {
+			t.Errorf("Unescape(Escape(%q)) = %q, %v", s, got, err)
+		}
+	}
+
+	roundTrip := func(s string) bool {
+		got, err := Unescape(Escape(s))
+		return err == nil && got == s
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if got, want := Escape("a\\b\"c\nd\te"), `a\\b\"c\nd\te`; got != want {
+		t.Errorf("Escape() = %s, want %s", got, want)
+	}
+
+	n := NewPair("k", "")
+	n.SetDecodedValue("a\n\"b\"")
+	if n.Value != `a\n\"b\"` {
+		t.Errorf("SetDecodedValue(): value = %s", n.Value)
+	}
+	if s, err := n.DecodedValue(); err != nil || s != "a\n\"b\"" {
+		t.Errorf("DecodedValue() = %q, %v", s, err)
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+		err  string // Start of the error message, empty if none
+	}{
+		{`no escape`, `no escape`, ""},
+		{`a\nb\tc\\d\"e`, "a\nb\tc\\d\"e", ""},
+		{`\\n`, `\n`, ""},
+		{`\x41 and \q`, `\x41 and \q`, `Unknown escape sequence \x at offset 0`},
+		{`a\n\`, "a\n\\", "Trailing backslash at offset 3"},
+		{`\r`, `\r`, `Unknown escape sequence \r`},
+	}
+	for _, tt := range tests {
+		got, err := Unescape(tt.s)
+		if got != tt.want {
+			t.Errorf("Unescape(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+		if (err == nil) != (len(tt.err) == 0) || (err != nil && !strings.HasPrefix(err.Error(), tt.err)) {
+			t.Errorf("Unescape(%q) err = %v, want %q", tt.s, err, tt.err)
+		}
+	}
+}
+
+func TestCheckEscapes(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string // Severity and message of each diagnostic
+	}{
+		{`a\nb\tc\\d\"e`, ""},
+		{`C:\dir`, `error Unknown escape sequence \d`},
+		{`a\\`, ""},
+		{`a\`, "error Trailing backslash"},
+		{"a\tb", "warning Literal tab in value"},
+		{"a\nb", "warning Literal line break in value"},
+		{"a\\\" \n\t\"b\\x", "error Backslash before the closing quote: the value runs on the next line"}, // Rest ignored
+		{`\q\"end`, `error Unknown escape sequence \q`},
+	}
+	v := &VDFFile{}
+	for _, tt := range tests {
+		diags, err := v.CheckEscapes(Token{Key: "k", Value: tt.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range diags {
+			if d.Rule != RuleEscape || d.Key != "k" || len(d.Fix) == 0 {
+				t.Errorf("CheckEscapes(%q): diagnostic %+v", tt.value, d)
+			}
+			got = append(got, d.Severity.String()+" "+d.Message)
+		}
+		if strings.Join(got, "|") != tt.want {
+			t.Errorf("CheckEscapes(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCheckEscapesPosition(t *testing.T) {
+	v, _ := NewFromBytes([]byte("\"lang\"\n{\n\t\"Tokens\"\n\t{\n\t\t\"k\"\t\"ab\\xc\"\n\t}\n}\n"), "x_french.txt")
+	toks, err := v.GetTokens()
+	if err != nil || len(toks) != 1 {
+		t.Fatalf("GetTokens() = %v, %v", toks, err)
+	}
+	diags, _ := v.CheckEscapes(toks[0])
+	if len(diags) != 1 || diags[0].Span.Start.String() != "x_french.txt:5:10" || diags[0].Span.End.Column != 12 {
+		t.Errorf("diagnostic %+v, want \\x on x_french.txt:5:10-12", diags)
+	}
+}
@@ -0,0 +1,346 @@
+package vdfloc
+
+// gettext PO/POT export and import (Poedit, Weblate, etc.)
+//
+// Each token variant of the english file is an entry:
+//	#. comment of the english token
+//	#. plural/gender warning for keys with a plural/gender suffix (:p, :gp, etc.)
+//	#: game_english.txt:42
+//	#, fuzzy                      translation made for a former english value
+//	#| msgid "former english value"
+//	msgctxt "a_key[$WIN32]"       key followed by its conditional statement if any
+//	msgid "english value"
+//	msgstr "translation"
+// Values are written with their escape sequences decoded then re-encoded as in C
+// (\n, \t, \", \\): the text is the same as in the loc file. Tokens with an empty
+// english value are skipped: an empty msgid is reserved for the header.
+// Files are read and written in UTF-8.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// POFile is the content of a PO file (see ImportPO()).
+type POFile struct {
+	Language string            // Language header e.g. pt_BR, empty if not set
+	Header   map[string]string // Header fields e.g. Project-Id-Version
+	Entries  []POEntry
+}
+
+// POEntry is an entry of a PO file.
+type POEntry struct {
+	Context  string   // msgctxt: key followed by its conditional statement if any
+	Key      string   // Key taken from the context
+	Cond     string   // Conditional statement taken from the context
+	ID       string   // msgid: english value
+	Str      string   // msgstr: translation, empty if none
+	Fuzzy    bool     // Flagged fuzzy: translation to be reviewed
+	Comments []string // Extracted comments (#.)
+	Line     int      // Line of the msgid in the file
+}
+
+// ExportPOT()
+//
+// Write the template of the english file in gettext POT format (see above).
+//
+func ExportPOT(en *VDFFile, w io.Writer) (err error) {
+	en.log(fmt.Sprintf("ExportPOT(%s)", en.fileName))
+	return exportPO(en, nil, w, true)
+}
+
+// ExportPO()
+//
+// Write the tokens of the english file with their translation in a loc file
+// in gettext PO format (see above). Entries are flagged fuzzy when the [english]
+// value kept in the loc file differs from the english file.
+//
+func ExportPO(en, target *VDFFile, w io.Writer) (err error) {
+	en.log(fmt.Sprintf("ExportPO(%s)", en.fileName))
+
+	if target == nil {
+		return fmt.Errorf("ExportPO() - No loc file: use ExportPOT()")
+	}
+	return exportPO(en, target, w, false)
+}
+
+func exportPO(en, target *VDFFile, w io.Writer, template bool) (err error) {
+	units, err := translationUnits(en, target)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	project, _ := splitLocFileName(en.fileName)
+	if len(project) == 0 {
+		project = en.fileName
+	}
+	header := "Project-Id-Version: " + project + "\n"
+	if !template {
+		if lang, ok := target.fileLanguage(); ok {
+			header += "Language: " + strings.Replace(lang.BCP47, "-", "_", -1) + "\n"
+		}
+	}
+	header += "MIME-Version: 1.0\nContent-Type: text/plain; charset=UTF-8\nContent-Transfer-Encoding: 8bit\n"
+	if template {
+		bw.WriteString("#, fuzzy\n")
+	}
+	bw.WriteString("msgid \"\"\n")
+	bw.WriteString("msgstr " + poQuote(header) + "\n")
+
+	for _, u := range units {
+		if len(u.Source) == 0 {
+			continue
+		}
+		bw.WriteString("\n")
+		if len(u.Comment) > 0 {
+			bw.WriteString("#. " + u.Comment + "\n")
+		}
+		if len(u.PluralGender) > 0 {
+			bw.WriteString(fmt.Sprintf("#. Plural/gender token (%s): keep the plural separators #|# and gender tags #|x|#, one form per plural/gender of the target language.\n", u.PluralGender))
+		}
+		if u.Line > 0 {
+			bw.WriteString(fmt.Sprintf("#: %s:%d\n", en.fileName, u.Line))
+		}
+		if u.Outdated {
+			bw.WriteString("#, fuzzy\n")
+			bw.WriteString("#| msgid " + strings.Replace(poQuote(u.PrevSource), "\n", "\n#| ", -1) + "\n")
+		}
+		bw.WriteString("msgctxt " + poQuote(u.Key+u.Cond) + "\n")
+		bw.WriteString("msgid " + poQuote(u.Source) + "\n")
+		if template {
+			bw.WriteString("msgstr \"\"\n")
+		} else {
+			bw.WriteString("msgstr " + poQuote(u.Target) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+var poEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t", "\r", "\\r")
+
+// poQuote()
+//
+// Returns a string in PO format: quoted and escaped, split after each line break
+// on several lines as gettext tools do.
+//
+func poQuote(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= 1 {
+		return "\"" + poEscaper.Replace(s) + "\""
+	}
+	res := "\"\""
+	for _, l := range lines {
+		res += "\n\"" + poEscaper.Replace(l) + "\""
+	}
+	return res
+}
+
+var poUnescapes = map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '"': '"', 'a': '\a', 'b': '\b', 'f': '\f', 'v': '\v'}
+
+// poUnquote decodes a quoted PO string
+func poUnquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("Quoted string expected: %s", s)
+	}
+	s = s[1 : len(s)-1]
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return "", fmt.Errorf("Unescaped double quote in %s", s)
+		case c != '\\':
+			b.WriteByte(c)
+		case i+1 == len(s):
+			return "", fmt.Errorf("Trailing backslash in %s", s)
+		default:
+			d, ok := poUnescapes[s[i+1]]
+			if !ok {
+				return "", fmt.Errorf("Unknown escape sequence \\%c in %s", s[i+1], s)
+			}
+			b.WriteByte(d)
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// ImportPO()
+//
+// Read a PO file in UTF-8 (see above). Obsolete entries (#~) are skipped.
+// See MergePO() to update a loc file.
+// err != nil if the file isn't valid PO, isn't in UTF-8 or holds plural entries
+// (msgid_plural, not used by loc files: plurals are in the values).
+//
+func ImportPO(r io.Reader) (po *POFile, err error) {
+	po = &POFile{Header: make(map[string]string)}
+
+	var e *POEntry
+	var field *string // field continued by the following quoted lines
+	var hasID bool
+	flush := func() error {
+		if e == nil {
+			return nil
+		}
+		if !hasID {
+			if len(e.Context) > 0 {
+				return fmt.Errorf("ImportPO() - line %d: entry without msgid", e.Line)
+			}
+			e, field = nil, nil // Comments only
+			return nil
+		}
+		if len(e.ID) == 0 && len(e.Context) == 0 {
+			po.setHeader(e.Str)
+		} else {
+			e.Key, e.Cond = splitContext(e.Context)
+			po.Entries = append(po.Entries, *e)
+		}
+		e, field, hasID = nil, nil, false
+		return nil
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024) // Long values
+	for nb := 1; sc.Scan(); nb++ {
+		line := strings.TrimSpace(sc.Text())
+		if nb == 1 {
+			line = strings.TrimPrefix(line, "\ufeff") // BOM
+		}
+
+		switch {
+		case len(line) == 0:
+			if err = flush(); err != nil {
+				return nil, err
+			}
+			continue
+		case strings.HasPrefix(line, "#~"): // Obsolete
+			continue
+		case strings.HasPrefix(line, "\""):
+			if field == nil {
+				return nil, fmt.Errorf("ImportPO() - line %d: string without keyword", nb)
+			}
+			s, err := poUnquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("ImportPO() - line %d: %v", nb, err)
+			}
+			*field += s
+			continue
+		}
+
+		// New entry when a comment or a msgctxt/msgid follows a msgstr
+		if e != nil && hasID && field == &e.Str && (strings.HasPrefix(line, "#") || strings.HasPrefix(line, "msgctxt") || strings.HasPrefix(line, "msgid")) {
+			if err = flush(); err != nil {
+				return nil, err
+			}
+		}
+		if e == nil {
+			e = &POEntry{Line: nb}
+		}
+
+		if strings.HasPrefix(line, "#") {
+			field = nil
+			switch {
+			case strings.HasPrefix(line, "#."):
+				e.Comments = append(e.Comments, strings.TrimSpace(line[2:]))
+			case strings.HasPrefix(line, "#,"):
+				for _, f := range strings.Split(line[2:], ",") {
+					if strings.TrimSpace(f) == "fuzzy" {
+						e.Fuzzy = true
+					}
+				}
+			}
+			continue
+		}
+
+		keyword, value := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			keyword, value = line[:i], strings.TrimSpace(line[i:])
+		}
+		s, err := poUnquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("ImportPO() - line %d: %v", nb, err)
+		}
+		switch keyword {
+		case "msgctxt":
+			e.Context, field = s, &e.Context
+		case "msgid":
+			e.ID, field, hasID = s, &e.ID, true
+			e.Line = nb
+		case "msgstr":
+			if !hasID {
+				return nil, fmt.Errorf("ImportPO() - line %d: msgstr without msgid", nb)
+			}
+			e.Str, field = s, &e.Str
+		case "msgid_plural":
+			return nil, fmt.Errorf("ImportPO() - line %d: plural entries are not supported", nb)
+		default:
+			return nil, fmt.Errorf("ImportPO() - line %d: unknown keyword %s", nb, keyword)
+		}
+	}
+	if err = sc.Err(); err != nil {
+		return nil, fmt.Errorf("ImportPO() - %v", err)
+	}
+	if err = flush(); err != nil {
+		return nil, err
+	}
+
+	if ct, ok := po.Header["Content-Type"]; ok {
+		if i := strings.Index(strings.ToLower(ct), "charset="); i >= 0 {
+			if cs := strings.TrimSpace(ct[i+len("charset="):]); !strings.EqualFold(cs, "UTF-8") && cs != "CHARSET" {
+				return nil, fmt.Errorf("ImportPO() - Unsupported charset %s: UTF-8 expected", cs)
+			}
+		}
+	}
+	po.Language = po.Header["Language"]
+	return po, nil
+}
+
+// setHeader reads the fields of the header entry
+func (po *POFile) setHeader(s string) {
+	for _, l := range strings.Split(s, "\n") {
+		if i := strings.Index(l, ":"); i > 0 {
+			po.Header[strings.TrimSpace(l[:i])] = strings.TrimSpace(l[i+1:])
+		}
+	}
+}
+
+// splitContext splits a msgctxt in key and conditional statement e.g. a_key[$WIN32] -> a_key, [$WIN32]
+func splitContext(ctx string) (key, cond string) {
+	if i := strings.LastIndex(ctx, "["); i > 0 && strings.HasSuffix(ctx, "]") {
+		return ctx[:i], ctx[i:]
+	}
+	return ctx, ""
+}
+
+// MergePO()
+//
+// Set the translations of a PO file in the loc file. Entries without translation
+// and fuzzy entries are ignored, as gettext tools do. Tokens keep their place and new
+// ones are inserted following the order of the PO file. Save() then writes the file
+// in its encoding. Returns the number of token variants added or modified.
+// err != nil if the language of the PO file isn't the one of the loc file
+// or if an entry has no msgctxt (the key is unknown).
+//
+func (v *VDFFile) MergePO(po *POFile) (merged int, err error) {
+	v.log(fmt.Sprintf("MergePO()"))
+
+	if err = v.checkLanguage(po.Language, "PO"); err != nil {
+		return 0, fmt.Errorf("MergePO() - %v", err)
+	}
+
+	var units []translationUnit
+	for _, e := range po.Entries {
+		if len(e.Context) == 0 {
+			return 0, fmt.Errorf("MergePO() - line %d: entry without msgctxt", e.Line)
+		}
+		units = append(units, translationUnit{Key: e.Key, Cond: e.Cond, Source: e.ID, Target: e.Str, Translated: len(e.Str) > 0 && !e.Fuzzy})
+	}
+	return v.mergeTranslations(units)
+}
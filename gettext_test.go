@@ -0,0 +1,122 @@
+package vdfloc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPORoundTrip(t *testing.T) {
+	en, fr := exchangeFiles(t)
+	var buf bytes.Buffer
+	if err := ExportPO(en, fr, &buf); err != nil {
+		t.Fatalf("ExportPO(): %v", err)
+	}
+	if !strings.Contains(buf.String(), "msgctxt \"a[$WIN32]\"\nmsgid \"He said \\\"yes\\\"\"\nmsgstr \"Il a dit \\\"oui\\\"\"\n") {
+		t.Errorf("ExportPO():\n%s", buf.String())
+	}
+
+	po, err := ImportPO(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportPO(): %v", err)
+	}
+	if po.Language != "fr" || len(po.Entries) != 7 {
+		t.Errorf("imported %s, %d entries", po.Language, len(po.Entries))
+	}
+	for _, e := range po.Entries {
+		if e.Key == "c" && (e.ID != "Real\ttab\r\non two lines" || e.Str != "Vraie\ttabulation\r\nsur deux lignes") {
+			t.Errorf("c = %q -> %q", e.ID, e.Str)
+		}
+		if e.Key == "a" && e.Cond == "[$WIN32]" && (len(e.Comments) != 1 || e.Comments[0] != "comment") {
+			t.Errorf("a[$WIN32] comments = %q", e.Comments)
+		}
+	}
+	checkMerge(t, fr, func(loc *VDFFile) (int, error) { return loc.MergePO(po) })
+}
+
+func TestPOTemplate(t *testing.T) {
+	en, _ := exchangeFiles(t)
+	var buf bytes.Buffer
+	if err := ExportPOT(en, &buf); err != nil {
+		t.Fatalf("ExportPOT(): %v", err)
+	}
+	po, err := ImportPO(&buf)
+	if err != nil {
+		t.Fatalf("ImportPO(): %v", err)
+	}
+	for _, e := range po.Entries {
+		if len(e.Str) > 0 {
+			t.Errorf("%s: msgstr %q in a template", e.Context, e.Str)
+		}
+	}
+	fr, _ := NewFromBytes([]byte(emptyFrench), "x_french.txt")
+	if merged, err := fr.MergePO(po); merged != 0 || err != nil {
+		t.Errorf("MergePO(template) = %d, %v", merged, err)
+	}
+}
+
+func TestPOFuzzyAndErrors(t *testing.T) {
+	src := "msgid \"\"\nmsgstr \"Language: fr\\n\"\n\n#, fuzzy\nmsgctxt \"a\"\nmsgid \"A\"\nmsgstr \"A fuzzy\"\n\nmsgctxt \"b\"\nmsgid \"B\"\nmsgstr \"\"\n\"B \"\n\"fr\"\n"
+	po, err := ImportPO(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ImportPO(): %v", err)
+	}
+	fr, _ := NewFromBytes([]byte(emptyFrench), "x_french.txt")
+	if merged, err := fr.MergePO(po); merged != 1 || err != nil {
+		t.Errorf("MergePO() = %d, %v, want the entry b only", merged, err)
+	}
+	if m, _ := fr.GetTokenInMap(); len(m) != 1 || m["b"] != "B fr" {
+		t.Errorf("tokens = %q", m)
+	}
+
+	for _, bad := range []string{
+		"msgid \"a\"\nmsgid_plural \"as\"\nmsgstr[0] \"\"\n",
+		"msgid \"\"\nmsgstr \"Content-Type: text/plain; charset=ISO-8859-1\\n\"\n",
+		"msgid \"unterminated\n",
+		"\"orphan\"\n",
+		"msgstr \"x\"\n",
+	} {
+		if _, err := ImportPO(strings.NewReader(bad)); err == nil {
+			t.Errorf("ImportPO(%q): no error", bad)
+		}
+	}
+
+	po, _ = ImportPO(strings.NewReader("msgid \"A\"\nmsgstr \"B\"\n"))
+	if _, err := fr.MergePO(po); err == nil {
+		t.Errorf("MergePO() without msgctxt: no error")
+	}
+}
+
+func TestPOLanguage(t *testing.T) {
+	tests := []struct {
+		file     string
+		language string
+		ok       bool
+	}{
+		{"x_french.txt", "fr", true},
+		{"x_french.txt", "fr_CA", true},
+		{"x_french.txt", "", true}, // Not set: not checked
+		{"x_french.txt", "de", false},
+		{"x_french.txt", "xx", false},
+		{"x_brazilian.txt", "pt_BR", true},
+		{"x_brazilian.txt", "pt_PT", false},
+		{"x_schinese.txt", "zh_CN", true},
+	}
+	for _, tt := range tests {
+		loc, _ := NewFromBytes([]byte("\"lang\" { \"Tokens\" { } }"), tt.file)
+		po := &POFile{Language: tt.language, Entries: []POEntry{{Context: "b", Key: "b", ID: "B", Str: "B2"}}}
+		merged, err := loc.MergePO(po)
+		if tt.ok && (err != nil || merged != 1) {
+			t.Errorf("MergePO(%s) in %s = %d, %v", tt.language, tt.file, merged, err)
+		}
+		if !tt.ok && (err == nil || merged != 0) {
+			t.Errorf("MergePO(%s) in %s = %d, %v, want an error", tt.language, tt.file, merged, err)
+		}
+	}
+
+	// The header comes first
+	loc, _ := NewFromBytes([]byte(emptyFrench), "x_german.txt")
+	if _, err := loc.MergePO(&POFile{Language: "de"}); err == nil || !strings.Contains(err.Error(), "french") {
+		t.Errorf("MergePO(de) in a french file named german: err = %v", err)
+	}
+}
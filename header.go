@@ -0,0 +1,131 @@
+package vdfloc
+
+// Header of loc files
+//
+//	"lang"
+//	{
+//		"Language"	"french"
+//		"Tokens"
+//		{
+//			...
+//		}
+//	}
+
+import (
+	"fmt"
+	"github.com/fabdem/go-vdfloc/config"
+	"strings"
+)
+
+// Header holds the fields of a loc file header.
+type Header struct {
+	Root         string   `json:"root"`               // Name of the root section e.g. lang
+	Language     string   `json:"language,omitempty"` // Declared language as written, empty if none
+	Sections     []string `json:"sections,omitempty"` // Names of the sections under the root e.g. Tokens
+	RootSpan     Span     `json:"rootSpan"`           // Location of the root section
+	LanguageSpan Span     `json:"languageSpan"`       // Location of the Language declaration if any
+	declared     bool     // A Language key was found
+}
+
+// ParseHeader()
+//
+// Returns the header fields of a loc file tree.
+// The root is the first section of the document; its "Language" key (case insensitive)
+// is the declared language.
+// err != nil if the tree has no section.
+//
+func ParseHeader(doc *Node) (h Header, err error) {
+	var root *Node
+	for _, n := range doc.Children {
+		if n.Type == NodeSection {
+			root = n
+			break
+		}
+	}
+	if root == nil {
+		return h, fmt.Errorf("No header found")
+	}
+
+	h.Root, h.RootSpan = root.Key, root.Span
+	for _, n := range root.Children {
+		switch {
+		case n.Type == NodeSection:
+			h.Sections = append(h.Sections, n.Key)
+		case n.Type == NodePair && strings.EqualFold(n.Key, "Language") && !h.declared: // first one wins
+			h.Language, h.LanguageSpan = n.Value, n.Span
+			h.declared = true
+		}
+	}
+	return h, nil
+}
+
+// HasLanguage returns true if a language is declared in the header.
+func (h Header) HasLanguage() bool {
+	return h.declared
+}
+
+// ParseHeader()
+//
+// Returns the header fields of the file (see ParseHeader()).
+//
+func (v *VDFFile) ParseHeader() (h Header, err error) {
+	v.log(fmt.Sprintf("ParseHeader()"))
+
+	doc, err := v.tree()
+	if err != nil {
+		return h, err
+	}
+	return ParseHeader(doc)
+}
+
+// CheckHeaderLanguage()
+//
+// Check the language declared in the header:
+//	- it has to be declared and be a Steam language (error)
+//	- it has to match the language of the file name suffix e.g. _french (error)
+//	- it should be defined in the plural/gender config (warning)
+// err != nil only in case of processing failure (e.g. no plural/gender config at all).
+//
+func (v *VDFFile) CheckHeaderLanguage() (diags Diagnostics, err error) {
+	v.log(fmt.Sprintf("CheckHeaderLanguage()"))
+
+	doc, err := v.tree()
+	if err != nil {
+		return diags, err
+	}
+
+	h, err := ParseHeader(doc)
+	if err != nil {
+		return diags, nil // No header: reported by the syntax check
+	}
+
+	if !h.HasLanguage() {
+		msg := fmt.Sprintf("No language declared in the header of %s", v.fileName)
+		diags = append(diags, Diagnostic{Rule: RuleHeaderLanguage, Severity: SeverityError, Message: msg, Span: h.RootSpan, Fix: "Add a \"Language\" key to the root section."})
+		return diags, nil
+	}
+
+	diag := func(sev Severity, msg, fix string) {
+		diags = append(diags, Diagnostic{Rule: RuleHeaderLanguage, Severity: sev, Message: msg, Key: "Language", Span: h.LanguageSpan, Fix: fix})
+	}
+
+	declared, ok := v.LookupLanguage(h.Language)
+	if !ok {
+		diag(SeverityError, fmt.Sprintf("Unknown language declared in the header: %s", h.Language), "")
+		return diags, nil
+	}
+
+	if fromName, nerr := LanguageFromFileName(v.fileName); nerr == nil && fromName.Name != declared.Name {
+		msg := fmt.Sprintf("Language declared in the header (%s) doesn't match the file name %s (%s)", h.Language, v.fileName, fromName.Name)
+		diag(SeverityError, msg, fmt.Sprintf("Declare %q or rename the file %s.", fromName.Name, FileNameForLanguage(v.fileName, declared)))
+	}
+
+	conf := v.pluralGenderConfig()
+	if conf == nil {
+		return diags, config.ErrNoConfig
+	}
+	if _, cerr := conf.GetPlural(declared.Name); cerr != nil {
+		diag(SeverityWarning, fmt.Sprintf("Language %s is not defined in the plural/gender config", declared.Name), "")
+	}
+	return diags, nil
+}
@@ -0,0 +1,104 @@
+package vdfloc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fabdem/go-vdfloc/config"
+)
+
+func TestParseHeader(t *testing.T) {
+	doc, _ := ParseFile("x.txt", []byte("// c\n\"lang\"\n{\n\t\"language\"\t\"French\"\n\t\"Language\"\t\"german\"\n\t\"Tokens\"\n\t{\n\t}\n\t\"Other\"\n\t{\n\t}\n}\n"))
+	h, err := ParseHeader(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Root != "lang" || h.Language != "French" || !h.HasLanguage() || strings.Join(h.Sections, " ") != "Tokens Other" {
+		t.Errorf("header = %+v", h)
+	}
+	if h.RootSpan.Start.Line != 2 || h.LanguageSpan.Start.Line != 4 {
+		t.Errorf("root line %d, language line %d, want 2 and 4", h.RootSpan.Start.Line, h.LanguageSpan.Start.Line)
+	}
+
+	doc, _ = ParseFile("x.txt", []byte("\"lang\" { \"Tokens\" { } }"))
+	if h, err = ParseHeader(doc); err != nil || h.HasLanguage() || len(h.Language) > 0 {
+		t.Errorf("header without language = %+v, %v", h, err)
+	}
+
+	doc, _ = ParseFile("x.txt", []byte("// nothing\n"))
+	if _, err = ParseHeader(doc); err == nil {
+		t.Error("ParseHeader() of a file without section: no error")
+	}
+}
+
+func TestCheckHeaderLanguage(t *testing.T) {
+	header := func(lang string) string {
+		if len(lang) > 0 {
+			lang = "\t\"Language\"\t\"" + lang + "\"\n"
+		}
+		return "\"lang\"\n{\n" + lang + "\t\"Tokens\"\n\t{\n\t}\n}\n"
+	}
+	tests := []struct {
+		name string
+		file string
+		text string
+		sev  Severity // -1 if no diagnostic
+		line int
+	}{
+		{"declared", "x_french.txt", header("french"), -1, 0},
+		{"case and code", "x_french.txt", header("FR"), -1, 0},
+		{"no suffix", "x.txt", header("german"), -1, 0},
+		{"missing", "x_french.txt", header(""), SeverityError, 1},
+		{"unknown", "x_french.txt", header("klingon"), SeverityError, 3},
+		{"mismatched", "x_french.txt", header("german"), SeverityError, 3},
+		{"alias", "x_koreana.txt", header("korean"), -1, 0},
+		{"empty file", "x_french.txt", "", -1, 0},
+	}
+	for _, tt := range tests {
+		v, _ := NewFromBytes([]byte(tt.text), tt.file)
+		diags, err := v.CheckHeaderLanguage()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tt.sev < 0 {
+			if len(diags) > 0 {
+				t.Errorf("%s: %v, want no diagnostic", tt.name, diags)
+			}
+			continue
+		}
+		if len(diags) != 1 {
+			t.Errorf("%s: %d diagnostics, want 1: %v", tt.name, len(diags), diags)
+			continue
+		}
+		if d := diags[0]; d.Rule != RuleHeaderLanguage || d.Severity != tt.sev || d.Pos().Line != tt.line {
+			t.Errorf("%s: diagnostic %v, want %v on line %d", tt.name, d, tt.sev, tt.line)
+		}
+	}
+
+	// The fix of a mismatch proposes both ways out
+	v, _ := NewFromBytes([]byte(header("german")), "x_french.txt")
+	diags, _ := v.CheckHeaderLanguage()
+	if len(diags) != 1 || !strings.Contains(diags[0].Fix, `"french"`) || !strings.Contains(diags[0].Fix, "x_german.txt") {
+		t.Errorf("mismatch = %v", diags)
+	}
+}
+
+func TestCheckHeaderLanguageConfig(t *testing.T) {
+	conf, err := config.NewFromBytes([]byte(`{"languages": [{"name": "french", "plural": 2}]}`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := NewFromBytes([]byte("\"lang\" { \"Language\" \"german\" }"), "x_german.txt")
+	v.SetPluralGenderConfig(conf)
+	diags, err := v.CheckHeaderLanguage()
+	if err != nil || len(diags) != 1 || diags[0].Severity != SeverityWarning || diags[0].Key != "Language" {
+		t.Errorf("german not in the config: %v, %v", diags, err)
+	}
+
+	v.SetPluralGenderConfig(nil)
+	if _, err = v.CheckHeaderLanguage(); !errors.Is(err, config.ErrNoConfig) {
+		t.Errorf("without config err = %v, want %v", err, config.ErrNoConfig)
+	}
+}
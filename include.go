@@ -0,0 +1,250 @@
+package vdfloc
+
+// #base and #include directives
+//
+// A KeyValues file can reference other files at its top level:
+//	#base "base_file.txt"
+//	#include "other_file.txt"
+// Paths are relative to the directory of the referencing file and can't go above the
+// root of the file system the file is read from (see GetMergedTree()).
+// As in the game:
+//	- the root keys of an #include file are added after the ones of the file
+//	- the keys of a #base file are merged in the ones of the file, which override them:
+//	  a section found in both is merged recursively, a pair found in both is the file's one
+// Directives are resolved only when a merged view is requested.
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// IncludeCycleError reports a file referencing itself through #base/#include directives.
+type IncludeCycleError struct {
+	Chain []string // Files in reference order, the last one being the first one
+}
+
+func (e *IncludeCycleError) Error() string {
+	return fmt.Sprintf("Include cycle: %s", strings.Join(e.Chain, " -> "))
+}
+
+// LoadMerged()
+//
+// Load a KeyValues file of a file system and resolve its #base and #include directives
+// recursively (see above). The positions of the nodes refer to the file they come from.
+// err != nil if a referenced file can't be read or in case of cycle (type *IncludeCycleError).
+// Syntax errors are ignored: the tree holds whatever could be parsed.
+//
+func LoadMerged(fsys fs.FS, name string) (doc *Node, err error) {
+	r := &includeResolver{fsys: fsys}
+	return r.load(cleanIncludePath(name), "", nil)
+}
+
+// GetMergedTree()
+//
+// Returns the tree of the file with its #base and #include directives resolved (see LoadMerged()).
+// The file is read again: the changes made to the tree of the instance are not included
+// and the merged tree can't be saved.
+// Referenced files are read from the directory of the file or from its file system (see NewFromFS()).
+// Files created with New() are rooted at their directory: to resolve a path going up
+// (e.g. #base "../base.res"), use NewFromFS() with a higher root such as os.DirFS("game/resource").
+//
+func (v *VDFFile) GetMergedTree() (doc *Node, err error) {
+	v.log(fmt.Sprintf("GetMergedTree()"))
+
+	if v.fsys == nil {
+		return nil, fmt.Errorf("GetMergedTree() - %s wasn't read from a file: referenced files can't be found", v.pathAndName)
+	}
+
+	buf, _, err := v.readSource()
+	if err != nil {
+		return nil, err
+	}
+	r := &includeResolver{fsys: v.fsys}
+	return r.resolve(v.fsName, v.fileName, buf, nil)
+}
+
+// GetMergedTokens()
+//
+// Same as GetTokens() on the merged tree (see GetMergedTree()): the tokens of the file,
+// which override the ones of its #base files, followed by the tokens of its #include files.
+// The origin of each token is available through Token.Origin().
+//
+func (v *VDFFile) GetMergedTokens() (tokens []Token, err error) {
+	v.log(fmt.Sprintf("GetMergedTokens()"))
+
+	doc, err := v.GetMergedTree()
+	if err != nil {
+		return tokens, err
+	}
+	for _, n := range mergedTokenPairs(doc, v.GetKeepSourceTokenFlag()) {
+		tokens = append(tokens, tokenFromNode(n))
+	}
+	return tokens, nil
+}
+
+type includeResolver struct {
+	fsys fs.FS
+}
+
+// load()
+//
+// Read, parse and resolve a file. label is the file name used in positions, the fs path if empty.
+// chain lists the files being loaded.
+//
+func (r *includeResolver) load(name string, label string, chain []string) (doc *Node, err error) {
+	f, err := r.fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open file %s - %v", name, err)
+	}
+	defer f.Close()
+
+	u, _, err := NewUTFReader(f, "")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read file %s - %v", name, err)
+	}
+	buf, err := ioutil.ReadAll(u)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read file %s - %v", name, err)
+	}
+	if len(label) == 0 {
+		label = name
+	}
+	return r.resolve(name, label, buf, chain)
+}
+
+// resolve()
+//
+// Parse a buffer holding the file name and resolve its directives.
+//
+func (r *includeResolver) resolve(name string, label string, buf []byte, chain []string) (doc *Node, err error) {
+	for _, c := range chain {
+		if c == name {
+			return nil, &IncludeCycleError{Chain: append(append([]string(nil), chain...), name)}
+		}
+	}
+	chain = append(chain, name)
+
+	doc, _ = ParseFile(label, buf) // Keep whatever could be parsed
+
+	var includes, bases []*Node
+	for _, n := range append([]*Node(nil), doc.Children...) {
+		if n.Type != NodePair {
+			continue
+		}
+		switch strings.ToLower(n.Key) {
+		case "#include":
+			includes = append(includes, n)
+		case "#base":
+			bases = append(bases, n)
+		default:
+			continue
+		}
+		removeDirective(doc, n)
+	}
+
+	dir := path.Dir(name)
+	for _, n := range append(append([]*Node(nil), includes...), bases...) {
+		if p := cleanIncludePath(path.Join(dir, n.Value)); p == ".." || strings.HasPrefix(p, "../") {
+			return nil, fmt.Errorf("%s %q of %s is outside of the file system root: use NewFromFS() with a higher root", n.Key, n.Value, name)
+		}
+	}
+	for _, n := range includes {
+		inc, err := r.load(cleanIncludePath(path.Join(dir, n.Value)), "", chain)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range append([]*Node(nil), inc.Children...) {
+			moveNode(c, doc)
+		}
+	}
+	for _, n := range bases {
+		base, err := r.load(cleanIncludePath(path.Join(dir, n.Value)), "", chain)
+		if err != nil {
+			return nil, err
+		}
+		mergeBase(doc, base)
+	}
+	return doc, nil
+}
+
+// mergeBase()
+//
+// Merge the children of a base section in a section: sections found in both are merged
+// recursively, pairs found in both (same key and conditional statement) are kept
+// from dst, the others are added at the end of dst.
+//
+func mergeBase(dst, base *Node) {
+	for _, c := range append([]*Node(nil), base.Children...) {
+		if c.Type == NodeComment {
+			continue
+		}
+
+		var match *Node
+		for _, d := range dst.ChildrenNamed(c.Key) {
+			if d.Type == c.Type && d.Cond == c.Cond {
+				match = d
+				break
+			}
+		}
+
+		switch {
+		case match == nil:
+			moveNode(c, dst)
+		case c.Type == NodeSection:
+			mergeBase(match, c)
+		}
+	}
+}
+
+// removeDirective removes a directive, the node following it taking its place so that no blank line is left
+func removeDirective(doc *Node, n *Node) {
+	if i := doc.IndexOf(n); i+1 < len(doc.Children) {
+		if next := doc.Children[i+1]; next.raw != nil && n.raw != nil {
+			next.raw.lead = n.raw.lead
+		}
+	}
+	doc.Remove(n)
+}
+
+// mergedTokenPairs()
+//
+// Returns the pairs of all the Tokens sections of a merged tree in document order:
+// the ones of the file (#base tokens merged) then the ones of the #include files.
+// Same as tokenPairsKeep() if there is no Tokens section.
+//
+func mergedTokenPairs(doc *Node, keepSource bool) (pairs []*Node) {
+	found := false
+	for _, s := range doc.Sections() {
+		if !strings.EqualFold(s.Key, "Tokens") {
+			continue
+		}
+		found = true
+		for _, n := range s.Pairs() {
+			if !isSourceKey(n.Key) || keepSource {
+				pairs = append(pairs, n)
+			}
+		}
+	}
+	if !found {
+		return tokenPairsKeep(doc, keepSource)
+	}
+	return pairs
+}
+
+// moveNode moves a node at the end of another tree making sure it starts on a new line
+func moveNode(n *Node, dst *Node) {
+	n.parent.Remove(n)
+	if n.raw != nil && !strings.Contains(n.raw.lead, "\n") {
+		n.raw.lead = "\n" + n.raw.lead
+	}
+	dst.add(n)
+}
+
+// cleanIncludePath returns a path usable with fs.FS: slashes, no leading ./ nor /
+func cleanIncludePath(name string) string {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	return strings.TrimPrefix(name, "/")
+}
@@ -0,0 +1,100 @@
+package vdfloc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// locTokens returns a loc file holding tokens given as key, value, key, value...
+func locTokens(directives string, kv ...string) *fstest.MapFile {
+	s := directives + "\"lang\"\n{\n\t\"Language\"\t\"english\"\n\t\"Tokens\"\n\t{\n"
+	for i := 0; i+1 < len(kv); i += 2 {
+		s += "\t\t\"" + kv[i] + "\"\t\"" + kv[i+1] + "\"\n"
+	}
+	return &fstest.MapFile{Data: []byte(s + "\t}\n}\n")}
+}
+
+func TestMergedTokens(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.txt":         locTokens("#base \"a.txt\"\n#include \"sub/b.txt\"\n\n", "a", "main a", "x", "X"),
+		"a.txt":            locTokens("", "a", "base a", "c", "3"),
+		"sub/b.txt":        locTokens("#base \"common/d.txt\"\n", "b", "2"),
+		"sub/common/d.txt": locTokens("", "d", "4"),
+	}
+	v, err := NewFromFS(fsys, "main.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := v.GetMergedTokens()
+	if err != nil {
+		t.Fatalf("GetMergedTokens(): %v", err)
+	}
+
+	// The file overrides its #base, #include tokens follow
+	var got []string
+	for _, tk := range tokens {
+		got = append(got, tk.Key+"="+tk.Value+"@"+tk.Origin())
+	}
+	want := "a=main a@main.txt x=X@main.txt c=3@a.txt b=2@sub/b.txt d=4@sub/common/d.txt"
+	if strings.Join(got, " ") != want {
+		t.Errorf("GetMergedTokens() = %s\nwant %s", strings.Join(got, " "), want)
+	}
+
+	// Directives are removed with the blanks before them
+	doc, err := v.GetMergedTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := string(doc.Bytes()); !strings.HasPrefix(out, "\"lang\"\n{\n\t\"Language\"") {
+		t.Errorf("merged tree starts with %q", out[:20])
+	}
+}
+
+func TestMergedTreeCycle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":     locTokens("#include \"dir/b.txt\"\n", "a", "1"),
+		"dir/b.txt": locTokens("#base \"../a.txt\"\n", "b", "2"),
+	}
+	_, err := LoadMerged(fsys, "a.txt")
+	var cycle *IncludeCycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("LoadMerged() err = %v, want an IncludeCycleError", err)
+	}
+	if got := strings.Join(cycle.Chain, " "); got != "a.txt dir/b.txt a.txt" {
+		t.Errorf("Chain = %s", got)
+	}
+
+	// The same file referenced twice is not a cycle
+	fsys["a.txt"] = locTokens("#include \"c.txt\"\n#base \"c.txt\"\n", "a", "1")
+	fsys["c.txt"] = locTokens("", "c", "3")
+	if _, err = LoadMerged(fsys, "a.txt"); err != nil {
+		t.Errorf("LoadMerged() = %v", err)
+	}
+}
+
+func TestMergedTreeOutsideRoot(t *testing.T) {
+	fsys := fstest.MapFS{
+		"res/ui.res": {Data: []byte("#base \"../base.res\"\n\"ui\" { \"k\" \"v\" }\n")},
+		"res/up.res": {Data: []byte("#include \"../../base.res\"\n\"ui\" { \"k\" \"v\" }\n")},
+		"base.res":   {Data: []byte("\"ui\" { \"b\" \"B\" }\n")},
+	}
+	doc, err := LoadMerged(fsys, "res/ui.res")
+	if err != nil {
+		t.Fatalf("LoadMerged(): %v", err)
+	}
+	if v, _ := doc.Get("ui", "b"); v != "B" {
+		t.Errorf("ui/b = %q, want the #base value", v)
+	}
+
+	if _, err = LoadMerged(fsys, "res/up.res"); err == nil || !strings.Contains(err.Error(), "outside of the file system root") {
+		t.Errorf("LoadMerged() err = %v, want a path outside of the root", err)
+	}
+
+	// Rooted at the directory of the file, as with New()
+	v, _ := NewFromFS(fstest.MapFS{"ui.res": fsys["res/ui.res"]}, "ui.res")
+	if _, err = v.GetMergedTree(); err == nil || !strings.Contains(err.Error(), "NewFromFS()") {
+		t.Errorf("GetMergedTree() err = %v, want a path outside of the root", err)
+	}
+}
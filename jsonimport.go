@@ -0,0 +1,526 @@
+package vdfloc
+
+// Strict json import
+//
+// Reads the versioned schema (see jsonmodel.go) and the legacy format of ConvVdf2json():
+//	{
+//		"!vdf file encoding!": "UTF16LE",
+//		"!vdf file header!": "\"lang\"\r\n{\r\n...\"Tokens\"\r\n\t{",
+//		"a_key": "a value",
+//		"a_key[[$WIN32]]": "a value on windows",
+//		"!vdf file footer!": "}\r\n}\r\n"
+//	}
+// The json is decoded as a stream. Anything not matching the format (e.g. a number or an
+// object where a string is expected, an unknown member) is rejected with its path and offset.
+// A json holding a format member is read as the versioned schema, as the legacy format otherwise.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	legacyEncodingKey = "!vdf file encoding!"
+	legacyHeaderKey   = "!vdf file header!"
+	legacyFooterKey   = "!vdf file footer!"
+)
+
+// JSONError reports a json not matching the expected format.
+type JSONError struct {
+	Path   string // Path of the offending value e.g. $.nodes[0].children[3].value
+	Offset int64  // Byte offset following the offending json token
+	Msg    string
+}
+
+func (e *JSONError) Error() string {
+	return fmt.Sprintf("%s (offset %d): %s", e.Path, e.Offset, e.Msg)
+}
+
+// ReadJSON()
+//
+// Create a new instance from a json file, versioned schema or legacy format (see above).
+// name is used for file name related functions and positions if the json doesn't hold
+// a file name (legacy format). The instance behaves as if created by NewFromBytes().
+// err != nil (type *JSONError) if the json is invalid or doesn't match the format.
+// Syntax errors in the KeyValues text of the legacy format are available through GetTree().
+//
+func ReadJSON(r io.Reader, name string, opts ...Options) (v *VDFFile, err error) {
+	if r == nil {
+		return nil, fmt.Errorf("Reader cannot be nil")
+	}
+	c, err := readJSON(r, name)
+	if err != nil {
+		return nil, err
+	}
+	v = newInstance(c.file, opts)
+	v.log(fmt.Sprintf("ReadJSON(%s)", c.file))
+	if err = v.setContent(c); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// jsonContent is a file read from json.
+type jsonContent struct {
+	file      string
+	encoding  string
+	doc       *Node
+	syntaxErr error // Syntax errors of the legacy KeyValues text
+}
+
+// legacyMember is a key/value of the legacy format along with its location.
+type legacyMember struct {
+	key, value string
+	path       string
+	offset     int64
+}
+
+// readJSON()
+//
+// Read a json file, versioned or legacy. name is used if the json holds no file name.
+//
+func readJSON(r io.Reader, name string) (c *jsonContent, err error) {
+	jr := newJSONReader(r)
+	if err = jr.delim('{'); err != nil {
+		return nil, err
+	}
+
+	const (
+		undecided = iota
+		versioned
+		legacy
+	)
+	mode := undecided
+	var jf jsonFile
+	var pending []legacyMember // file and encoding members read before the format is known
+	var members []legacyMember // legacy format
+	seen := make(map[string]bool)
+
+	for {
+		key, end, err := jr.key()
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			break
+		}
+		jr.push(memberPath(key))
+
+		// Tokens can be repeated in the legacy format
+		schemaKey := key == "format" || key == "version" || key == "newLine" || key == "nodes"
+		legacyKey := key == legacyEncodingKey || key == legacyHeaderKey || key == legacyFooterKey
+		if seen[key] && (mode == versioned || schemaKey || legacyKey) {
+			return nil, jr.errorf("Duplicate member %q", key)
+		}
+		seen[key] = true
+
+		switch {
+		case mode != legacy && schemaKey:
+			if mode == undecided {
+				mode = versioned
+				for _, m := range pending {
+					if err = jf.set(m); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if err = jr.versionedMember(&jf, key); err != nil {
+				return nil, err
+			}
+
+		case mode != legacy && (key == "file" || key == "encoding"):
+			value, err := jr.str()
+			if err != nil {
+				return nil, err
+			}
+			m := legacyMember{key, value, jr.pathString(), jr.dec.InputOffset()}
+			if mode == versioned {
+				if err = jf.set(m); err != nil {
+					return nil, err
+				}
+			} else {
+				pending = append(pending, m)
+			}
+
+		case mode == versioned:
+			return nil, jr.errorf("Unknown member %q", key)
+
+		default:
+			mode = legacy
+			members, pending = append(members, pending...), nil
+			value, err := jr.str()
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, legacyMember{key, value, jr.pathString(), jr.dec.InputOffset()})
+		}
+		jr.pop()
+	}
+	if err = jr.eof(); err != nil {
+		return nil, err
+	}
+
+	if mode == versioned {
+		if len(jf.Format) == 0 {
+			return nil, jr.errorf("Member format missing")
+		}
+		if len(jf.File) == 0 {
+			jf.File = name
+		}
+		if len(jf.File) == 0 {
+			return nil, jr.errorf("File name cannot be empty")
+		}
+		doc, err := jf.tree()
+		if err != nil {
+			return nil, jr.errorf("%v", err)
+		}
+		return &jsonContent{file: jf.File, encoding: jf.Encoding, doc: doc}, nil
+	}
+
+	if len(name) == 0 {
+		return nil, jr.errorf("File name cannot be empty")
+	}
+	return legacyContent(append(members, pending...), name)
+}
+
+// set sets the file or encoding member of the versioned schema
+func (jf *jsonFile) set(m legacyMember) error {
+	switch m.key {
+	case "file":
+		jf.File = m.value
+	case "encoding":
+		if err := checkEncodingName(m.value); err != nil {
+			return &JSONError{Path: m.path, Offset: m.offset, Msg: err.Error()}
+		}
+		jf.Encoding = m.value
+	}
+	return nil
+}
+
+// versionedMember()
+//
+// Read a member of the versioned schema other than file and encoding.
+//
+func (jr *jsonReader) versionedMember(jf *jsonFile, key string) (err error) {
+	switch key {
+	case "format":
+		if jf.Format, err = jr.str(); err != nil {
+			return err
+		}
+		if jf.Format != JSONFormat {
+			return jr.errorf("Unsupported json format %q - %q expected", jf.Format, JSONFormat)
+		}
+	case "version":
+		if jf.Version, err = jr.integer(); err != nil {
+			return err
+		}
+		if jf.Version < 1 || jf.Version > JSONVersion {
+			return jr.errorf("Unsupported json schema version %d - %d at most", jf.Version, JSONVersion)
+		}
+	case "newLine":
+		if jf.NewLine, err = jr.str(); err != nil {
+			return err
+		}
+		if jf.NewLine != "\n" && jf.NewLine != "\r\n" {
+			return jr.errorf("Invalid line break %q", jf.NewLine)
+		}
+	case "nodes":
+		jf.Nodes, err = jr.nodes()
+	}
+	return err
+}
+
+// legacyContent()
+//
+// Build the file of the legacy format: header, tokens and footer are written as
+// ConvJson2VdfWriter() always did then parsed.
+//
+func legacyContent(members []legacyMember, name string) (c *jsonContent, err error) {
+	c = &jsonContent{file: name}
+	var header, footer string
+	var tokens strings.Builder
+
+	for _, m := range members {
+		switch m.key {
+		case legacyEncodingKey:
+			if err = checkEncodingName(m.value); err != nil {
+				return nil, &JSONError{Path: m.path, Offset: m.offset, Msg: err.Error()}
+			}
+			c.encoding = m.value
+			continue
+		case legacyHeaderKey:
+			header = m.value
+			continue
+		case legacyFooterKey:
+			footer = m.value
+			continue
+		}
+
+		key, cond, err := splitJsonKey(m.key)
+		if err != nil {
+			return nil, &JSONError{Path: m.path, Offset: m.offset, Msg: err.Error()}
+		}
+		tokens.WriteString("\"" + key + "\"\t\"" + m.value + "\"")
+		if len(cond) > 0 {
+			tokens.WriteString("\t" + cond)
+		}
+		tokens.WriteString("\r\n")
+	}
+
+	buf := header + "\r\n\r\n" + tokens.String() + "\r\n" + footer
+	c.doc, c.syntaxErr = ParseFile(name, []byte(buf))
+	return c, nil
+}
+
+// jsonReader decodes a json stream token by token keeping track of the path.
+type jsonReader struct {
+	dec  *json.Decoder
+	path []string
+}
+
+func newJSONReader(r io.Reader) *jsonReader {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &jsonReader{dec: dec}
+}
+
+func (jr *jsonReader) push(elem string) {
+	jr.path = append(jr.path, elem)
+}
+
+func (jr *jsonReader) pop() {
+	jr.path = jr.path[:len(jr.path)-1]
+}
+
+func (jr *jsonReader) pathString() string {
+	return "$" + strings.Join(jr.path, "")
+}
+
+func (jr *jsonReader) errorf(format string, a ...interface{}) *JSONError {
+	return &JSONError{Path: jr.pathString(), Offset: jr.dec.InputOffset(), Msg: fmt.Sprintf(format, a...)}
+}
+
+var reIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// memberPath returns the path element of an object member: .name or ["a name"]
+func memberPath(key string) string {
+	if reIdentifier.MatchString(key) {
+		return "." + key
+	}
+	return "[" + strconv.Quote(key) + "]"
+}
+
+// token reads the next json token, the end of the data being an error
+func (jr *jsonReader) token() (json.Token, error) {
+	t, err := jr.dec.Token()
+	if err == io.EOF {
+		return nil, jr.errorf("Unexpected end of data")
+	}
+	if err != nil {
+		return nil, jr.errorf("%v", err)
+	}
+	return t, nil
+}
+
+// eof checks that nothing follows the value read
+func (jr *jsonReader) eof() error {
+	if _, err := jr.dec.Token(); err != io.EOF {
+		return jr.errorf("Unexpected data after the end of the json value")
+	}
+	return nil
+}
+
+func (jr *jsonReader) delim(d json.Delim) error {
+	t, err := jr.token()
+	if err != nil {
+		return err
+	}
+	if t != d {
+		return jr.errorf("%s expected, found %s", describeToken(d), describeToken(t))
+	}
+	return nil
+}
+
+func (jr *jsonReader) str() (string, error) {
+	t, err := jr.token()
+	if err != nil {
+		return "", err
+	}
+	s, ok := t.(string)
+	if !ok {
+		return "", jr.errorf("String expected, found %s", describeToken(t))
+	}
+	return s, nil
+}
+
+func (jr *jsonReader) integer() (int, error) {
+	t, err := jr.token()
+	if err != nil {
+		return 0, err
+	}
+	n, ok := t.(json.Number)
+	if !ok {
+		return 0, jr.errorf("Integer expected, found %s", describeToken(t))
+	}
+	i, err := strconv.Atoi(n.String())
+	if err != nil {
+		return 0, jr.errorf("Integer expected, found %s", n)
+	}
+	return i, nil
+}
+
+// key reads the next member name of an object, end is set at the end of the object.
+func (jr *jsonReader) key() (key string, end bool, err error) {
+	t, err := jr.token()
+	if err != nil {
+		return "", false, err
+	}
+	if t == json.Delim('}') {
+		return "", true, nil
+	}
+	return t.(string), false, nil // The decoder only returns strings as member names
+}
+
+// nodes reads an array of nodes
+func (jr *jsonReader) nodes() (list []*jsonNode, err error) {
+	if err = jr.delim('['); err != nil {
+		return nil, err
+	}
+	for i := 0; jr.dec.More(); i++ {
+		jr.push(fmt.Sprintf("[%d]", i))
+		n, err := jr.node(false)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+		jr.pop()
+	}
+	return list, jr.delim(']')
+}
+
+// node()
+//
+// Read a node of the versioned schema. A document is accepted only if allowDoc is set.
+//
+func (jr *jsonReader) node(allowDoc bool) (j *jsonNode, err error) {
+	if err = jr.delim('{'); err != nil {
+		return nil, err
+	}
+	j = &jsonNode{}
+	seen := make(map[string]bool)
+	for {
+		key, end, err := jr.key()
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			break
+		}
+		jr.push(memberPath(key))
+		if seen[key] {
+			return nil, jr.errorf("Duplicate member %q", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "type":
+			j.Type, err = jr.str()
+		case "key":
+			j.Key, err = jr.str()
+		case "value":
+			var s string
+			s, err = jr.str()
+			j.Value = &s
+		case "valueType":
+			j.ValueType, err = jr.str()
+		case "condition":
+			j.Condition, err = jr.str()
+			if err == nil && len(j.Condition) > 0 {
+				if _, cerr := ParseCond(j.Condition); cerr != nil {
+					err = jr.errorf("%v", cerr)
+				}
+			}
+		case "comment":
+			j.Comment, err = jr.str()
+		case "position":
+			j.Position, err = jr.position()
+		case "children":
+			j.Children, err = jr.nodes()
+		default:
+			err = jr.errorf("Unknown member %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		jr.pop()
+	}
+
+	if _, _, err = j.check(allowDoc); err != nil {
+		return nil, jr.errorf("%v", err)
+	}
+	return j, nil
+}
+
+// position reads the position of a node
+func (jr *jsonReader) position() (pos *Position, err error) {
+	if err = jr.delim('{'); err != nil {
+		return nil, err
+	}
+	pos = &Position{}
+	for {
+		key, end, err := jr.key()
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			break
+		}
+		jr.push(memberPath(key))
+		switch key {
+		case "file":
+			pos.File, err = jr.str()
+		case "line":
+			pos.Line, err = jr.integer()
+		case "column":
+			pos.Column, err = jr.integer()
+		case "offset":
+			pos.Offset, err = jr.integer()
+		default:
+			err = jr.errorf("Unknown member %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		jr.pop()
+	}
+	return pos, nil
+}
+
+// describeToken names the kind of a json token for error messages
+func describeToken(t json.Token) string {
+	switch t := t.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			return "object"
+		case '[':
+			return "array"
+		case '}':
+			return "end of object"
+		}
+		return "end of array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%v", t)
+}
@@ -0,0 +1,137 @@
+package vdfloc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Values with escaped quotes, escape sequences, real tabs and line breaks
+const exchangeFile = "\"lang\"\r\n{\r\n\t\"Language\"\t\"french\"\r\n\t\"Tokens\"\r\n\t{\r\n" +
+	"\t\t\"a\"\t\"Il a dit \\\"oui\\\"\"\t[$WIN32]\t// comment\r\n" +
+	"\t\t\"a\"\t\"Mac\"\t[$OSX]\r\n" +
+	"\t\t\"b\"\t\"Ligne 1\\nLigne 2\\tTab\"\r\n" +
+	"\t\t\"c\"\t\"Vraie\ttabulation\r\nsur deux lignes\"\r\n" +
+	"\t\t\"d\"\t\"Antislash \\\\ é\"\r\n" +
+	"\t}\r\n}\r\n"
+
+// encode returns a utf8 text in an encoding (BOM included)
+func encode(t *testing.T, s string, enc string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	u, err := NewUTFWriter(&buf, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Write([]byte(s))
+	u.Flush()
+	return buf.Bytes()
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, enc := range []string{"UTF8", "UTF16LE"} {
+		src := encode(t, exchangeFile, enc)
+		v, _ := NewFromBytes(src, "x_french.txt")
+
+		var js bytes.Buffer
+		if err := v.WriteJSON(&js); err != nil {
+			t.Fatalf("%s: WriteJSON(): %v", enc, err)
+		}
+		w, err := ReadJSON(&js, "ignored.txt")
+		if err != nil {
+			t.Fatalf("%s: ReadJSON(): %v", enc, err)
+		}
+		if w.fileName != "x_french.txt" || w.GetEncoding() != enc {
+			t.Errorf("%s: read back %s in %s", enc, w.fileName, w.GetEncoding())
+		}
+		var out bytes.Buffer
+		if err = w.Write(&out); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), src) {
+			t.Errorf("%s: round-trip gives\n%q\nwant\n%q", enc, out.Bytes(), src)
+		}
+	}
+}
+
+func TestJSONLegacyRoundTrip(t *testing.T) {
+	src := encode(t, exchangeFile, "UTF16LE")
+	v, _ := NewFromBytes(src, "x_french.txt")
+
+	var js bytes.Buffer
+	if err := v.ConvVdf2jsonWriter(&js); err != nil {
+		t.Fatalf("ConvVdf2jsonWriter(): %v", err)
+	}
+	w, err := ReadJSON(bytes.NewReader(js.Bytes()), "x_french.txt")
+	if err != nil {
+		t.Fatalf("ReadJSON(): %v", err)
+	}
+	m, _ := w.GetTokenInMap()
+	if m["b"] != "Ligne 1\\nLigne 2\\tTab" || m["c"] != "Vraie\ttabulation\r\nsur deux lignes" || m["d"] != "Antislash \\\\ é" {
+		t.Errorf("tokens read back: %q", m)
+	}
+
+	var out bytes.Buffer
+	if err := ConvJson2VdfWriter(bytes.NewReader(js.Bytes()), &out); err != nil {
+		t.Fatalf("ConvJson2VdfWriter(): %v", err)
+	}
+	back, _ := NewFromBytes(out.Bytes(), "x_french.txt") // Legacy format: values and encoding kept, not the layout
+	m2, _ := back.GetTokenInMap()
+	if len(m2) != 4 || m2["c"] != m["c"] || m2["d"] != m["d"] {
+		t.Errorf("tokens converted back: %q", m2)
+	}
+	if enc := back.GetEncoding(); enc != "UTF16LE" {
+		t.Errorf("converted back in %s, want UTF16LE", enc)
+	}
+}
+
+func TestJSONLegacyEdited(t *testing.T) {
+	v, _ := NewFromBytes([]byte(exchangeFile), "x_french.txt")
+	v.Set("b", "B2")
+	v.Delete("d")
+	doc, _ := v.GetTree()
+	doc.Find("lang", "Language").Value = "french2"
+
+	var js bytes.Buffer
+	if err := v.ConvVdf2jsonWriter(&js); err != nil {
+		t.Fatalf("ConvVdf2jsonWriter(): %v", err)
+	}
+	var m map[string]string
+	if err := json.Unmarshal(js.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(m["!vdf file header!"], "\"french2\"") || m["!vdf file footer!"] != "}\r\n}\r\n" {
+		t.Errorf("header %q, footer %q", m["!vdf file header!"], m["!vdf file footer!"])
+	}
+	if _, ok := m["d"]; ok || m["b"] != "B2" {
+		t.Errorf("edits not exported: %q", m)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		json string
+		path string
+	}{
+		{`[]`, "$"},
+		{`{"format": "vdfloc", "version": 2, "nodes": []}`, "$.version"},
+		{`{"format": "vdfloc", "version": 1, "nodes": [{"type": "pair", "key": 3}]}`, "$.nodes[0].key"},
+		{`{"format": "vdfloc", "version": 1, "nodes": [{"type": "section", "key": "s", "children": [{"type": "pair", "key": "k", "value": "v", "valueType": "double"}]}]}`, "$.nodes[0].children[0]"},
+		{`{"format": "vdfloc", "version": 1, "nodes": [], "extra": true}`, "$.extra"},
+		{`{"format": "vdfloc", "format": "vdfloc"}`, "$.format"},
+		{`{"a": 1}`, "$.a"},
+	}
+	for _, tt := range tests {
+		_, err := ReadJSON(strings.NewReader(tt.json), "x.txt")
+		var je *JSONError
+		if !errors.As(err, &je) {
+			t.Errorf("%s: err = %v, want a *JSONError", tt.json, err)
+			continue
+		}
+		if je.Path != tt.path {
+			t.Errorf("%s: path %s, want %s (%v)", tt.json, je.Path, tt.path, je)
+		}
+	}
+}
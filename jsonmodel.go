@@ -0,0 +1,343 @@
+package vdfloc
+
+// JSON model of a KeyValues file
+//
+// Versioned schema replacing the legacy format of ConvVdf2json() (magic keys and
+// conditional statements glued to keys), which stays available for compatibility.
+//
+//	{
+//		"format": "vdfloc",            always vdfloc
+//		"version": 1,                  schema version
+//		"file": "game_french.txt",     file name
+//		"encoding": "UTF16LE",         encoding of the file (see GetEncoding())
+//		"newLine": "\r\n",             line break used in the file, \n if omitted
+//		"nodes": [ ... ]               top level nodes in file order
+//	}
+//
+// Each node is an object:
+//	"type"       pair, section or comment
+//	"key"        key of a pair or name of a section
+//	"value"      value of a pair, always present for pairs
+//	"valueType"  int32, float32, pointer, color, uint64 or int64 for binary KeyValues, omitted for strings
+//	"condition"  conditional statement with its brackets e.g. [$WIN32], omitted if none
+//	"comment"    trailing comment of a pair or text of a comment node, // included
+//	"position"   {"file", "line", "column", "offset"} of the node in the source, omitted if unknown;
+//	             file is omitted if it is the file of the document
+//	"children"   nodes of a section, omitted if empty
+//
+// Keys, values and comments are stored as written in the file (escape sequences are not decoded).
+// All the nodes are kept: nested sections, comments, [english] tokens and variants of a token
+// with different conditional statements. Blanks are not: a file read from json is written
+// with the default layout (one tab per level of depth).
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	JSONFormat  = "vdfloc" // Value of the format field
+	JSONVersion = 1        // Latest version of the schema
+)
+
+// jsonFile is the json representation of a file (see above).
+type jsonFile struct {
+	Format   string      `json:"format"`
+	Version  int         `json:"version"`
+	File     string      `json:"file"`
+	Encoding string      `json:"encoding,omitempty"`
+	NewLine  string      `json:"newLine,omitempty"`
+	Nodes    []*jsonNode `json:"nodes"`
+}
+
+// jsonNode is the json representation of a node (see above).
+type jsonNode struct {
+	Type      string      `json:"type"`
+	Key       string      `json:"key,omitempty"`
+	Value     *string     `json:"value,omitempty"`
+	ValueType string      `json:"valueType,omitempty"`
+	Condition string      `json:"condition,omitempty"`
+	Comment   string      `json:"comment,omitempty"`
+	Position  *Position   `json:"position,omitempty"`
+	Children  []*jsonNode `json:"children,omitempty"`
+}
+
+var nodeTypeNames = map[NodeType]string{
+	NodeDocument: "document",
+	NodeSection:  "section",
+	NodePair:     "pair",
+	NodeComment:  "comment",
+}
+
+// MarshalJSON()
+//
+// Serialize the node and its descendants (see the schema above).
+// A document is serialized as a node of type document.
+//
+func (n *Node) MarshalJSON() ([]byte, error) {
+	return marshalJSON(toJSONNode(n, ""))
+}
+
+// UnmarshalJSON()
+//
+// Read a node serialized by MarshalJSON().
+// err != nil (type *JSONError) if the json doesn't follow the schema.
+//
+func (n *Node) UnmarshalJSON(b []byte) error {
+	jr := newJSONReader(bytes.NewReader(b))
+	j, err := jr.node(true)
+	if err != nil {
+		return err
+	}
+	m, err := fromJSONNode(j, "", true)
+	if err != nil {
+		return err
+	}
+	parent := n.parent
+	*n = *m
+	n.parent = parent
+	for _, c := range n.Children {
+		c.parent = n
+	}
+	return nil
+}
+
+// MarshalJSON()
+//
+// Serialize the file (see the schema above). Syntax errors are ignored:
+// the json holds whatever could be parsed.
+//
+func (v *VDFFile) MarshalJSON() ([]byte, error) {
+	v.log(fmt.Sprintf("MarshalJSON()"))
+
+	doc, err := v.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	jf := jsonFile{
+		Format:   JSONFormat,
+		Version:  JSONVersion,
+		File:     v.fileName,
+		Encoding: v.encodingName(),
+		Nodes:    []*jsonNode{},
+	}
+	if doc.raw != nil && doc.raw.nl != "\n" {
+		jf.NewLine = doc.raw.nl
+	}
+	for _, c := range doc.Children {
+		jf.Nodes = append(jf.Nodes, toJSONNode(c, v.fileName))
+	}
+	return marshalJSON(jf)
+}
+
+// UnmarshalJSON()
+//
+// Replace the content of the instance with a json file (see ReadJSON()).
+// The instance then behaves as if created by NewFromBytes(): Save() is not available.
+//
+func (v *VDFFile) UnmarshalJSON(b []byte) error {
+	c, err := readJSON(bytes.NewReader(b), v.pathAndName)
+	if err != nil {
+		return err
+	}
+	return v.setContent(c)
+}
+
+// setContent()
+//
+// Replace the content of the instance with a file read from json.
+//
+func (v *VDFFile) setContent(c *jsonContent) error {
+	// Serialize the tree so that the functions reading the source see the same content
+	var buf bytes.Buffer
+	u, err := NewUTFWriter(&buf, c.encoding)
+	if err != nil {
+		return fmt.Errorf("Unable to load %s - %v", c.file, err)
+	}
+	if _, err = c.doc.WriteTo(u); err == nil {
+		err = u.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to load %s - %v", c.file, err)
+	}
+	src := buf.Bytes()
+
+	d := newInstance(c.file, nil)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.maxKeyLen == 0 { // Zero instance: take the defaults
+		v.debug, v.logWriter, v.conf, v.maxKeyLen = d.debug, d.logWriter, d.conf, d.maxKeyLen
+	}
+	if v.f != nil {
+		v.f.Close()
+		v.f = nil
+	}
+	v.pathAndName, v.fileName = d.pathAndName, d.fileName
+	v.open = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(src)), nil }
+	v.isFile = false
+	v.fsys, v.fsName = nil, ""
+	v.encoding = c.encoding
+	v.doc, v.syntaxErr = c.doc, c.syntaxErr
+	return nil
+}
+
+// WriteJSON()
+//
+// Write the file in json (see the schema above), indented.
+// See ConvVdf2jsonWriter() for the legacy format.
+//
+func (v *VDFFile) WriteJSON(out io.Writer) (err error) {
+	v.log(fmt.Sprintf("WriteJSON()"))
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "\t")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// marshalJSON is json.Marshal() without escaping <, > and &: markup is common in values
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// tree()
+//
+// Build the tree of a json file checked by the reader (see ReadJSON()).
+//
+func (jf *jsonFile) tree() (doc *Node, err error) {
+	nl := jf.NewLine
+	if len(nl) == 0 { // Omitted: \n (see the schema above)
+		nl = "\n"
+	}
+	doc = &Node{Type: NodeDocument, raw: &nodeRaw{nl: nl, closeLead: nl}}
+	for _, j := range jf.Nodes {
+		n, err := fromJSONNode(j, jf.File, false)
+		if err != nil {
+			return nil, err
+		}
+		doc.add(n)
+	}
+	return doc, nil
+}
+
+// toJSONNode()
+//
+// Build the json representation of a node. The file name of the positions
+// is omitted if it is file.
+//
+func toJSONNode(n *Node, file string) *jsonNode {
+	j := &jsonNode{
+		Type:      nodeTypeNames[n.Type],
+		Key:       n.Key,
+		Condition: n.Cond,
+		Comment:   n.Comment,
+	}
+	if n.Type == NodePair {
+		value := n.Value
+		j.Value = &value
+		if n.ValueType != 0 && n.ValueType != ValueString {
+			j.ValueType = n.ValueType.String()
+		}
+	}
+	if pos := n.Span.Start; pos.IsValid() {
+		if pos.File == file {
+			pos.File = ""
+		}
+		j.Position = &pos
+	}
+	for _, c := range n.Children {
+		j.Children = append(j.Children, toJSONNode(c, file))
+	}
+	return j
+}
+
+// check()
+//
+// Check the consistency of a node (not of its children) and returns its type and value type.
+// A document is accepted only if allowDoc is set.
+//
+func (j *jsonNode) check(allowDoc bool) (t NodeType, vt ValueType, err error) {
+	found := false
+	for nt, name := range nodeTypeNames {
+		if name == j.Type {
+			t, found = nt, true
+		}
+	}
+	switch {
+	case !found:
+		return t, vt, fmt.Errorf("Invalid node type %q", j.Type)
+	case t == NodeDocument && !allowDoc:
+		return t, vt, fmt.Errorf("Node of type document nested in a document")
+	case t == NodePair && j.Value == nil:
+		return t, vt, fmt.Errorf("Pair %s without value", j.Key)
+	case t != NodePair && (j.Value != nil || len(j.ValueType) > 0):
+		return t, vt, fmt.Errorf("Value in a node of type %s", j.Type)
+	case t != NodeSection && t != NodeDocument && len(j.Children) > 0:
+		return t, vt, fmt.Errorf("Children in a node of type %s", j.Type)
+	}
+	if len(j.ValueType) > 0 {
+		if vt, err = parseValueType(j.ValueType); err != nil {
+			return t, vt, err
+		}
+	}
+	return t, vt, nil
+}
+
+// fromJSONNode()
+//
+// Build a node out of its json representation. Positions without file name get file.
+// A document is accepted only if allowDoc is set.
+//
+func fromJSONNode(j *jsonNode, file string, allowDoc bool) (n *Node, err error) {
+	if j == nil {
+		return nil, fmt.Errorf("Invalid node: null")
+	}
+
+	n = &Node{Key: j.Key, Cond: normalizeCond(j.Condition), Comment: j.Comment}
+	if n.Type, n.ValueType, err = j.check(allowDoc); err != nil {
+		return nil, err
+	}
+	if j.Value != nil {
+		n.Value = *j.Value
+	}
+	if len(n.Comment) > 0 {
+		n.Comment = formatComment(n.Comment)
+	}
+	if j.Position != nil {
+		n.Span.Start = *j.Position
+		if len(n.Span.Start.File) == 0 {
+			n.Span.Start.File = file
+		}
+		n.Span.End = n.Span.Start
+	}
+
+	for _, jc := range j.Children {
+		c, err := fromJSONNode(jc, file, false)
+		if err != nil {
+			return nil, err
+		}
+		n.add(c)
+	}
+	return n, nil
+}
+
+// parseValueType returns the value type matching a name (see ValueType.String())
+func parseValueType(name string) (ValueType, error) {
+	for _, t := range []ValueType{ValueString, ValueInt32, ValueFloat32, ValuePointer, ValueColor, ValueUint64, ValueInt64} {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid value type %q", name)
+}
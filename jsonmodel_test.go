@@ -0,0 +1,176 @@
+package vdfloc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// jsonMap returns a json object decoded in a map
+func jsonMap(t *testing.T, b []byte) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, b)
+	}
+	return m
+}
+
+func TestJSONModelValueTypes(t *testing.T) {
+	types := []ValueType{ValueString, ValueInt32, ValueFloat32, ValuePointer, ValueColor, ValueUint64, ValueInt64}
+	s := NewSection("root")
+	for _, vt := range types {
+		p := NewPair(vt.String(), "1")
+		p.ValueType = vt
+		s.add(p)
+	}
+	s.add(NewPair("empty", "")) // Value always present for pairs
+
+	b, err := s.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	children := jsonMap(t, b)["children"].([]interface{})
+	for i, c := range children {
+		m := c.(map[string]interface{})
+		want := m["key"]
+		if want == "string" || want == "empty" { // Omitted for strings
+			want = nil
+		}
+		if m["valueType"] != want {
+			t.Errorf("child %d: valueType = %v, want %v", i, m["valueType"], want)
+		}
+		if _, ok := m["value"]; !ok {
+			t.Errorf("child %d without value: %v", i, m)
+		}
+	}
+
+	var back Node
+	if err = json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Children) != len(types)+1 || back.Key != "root" || back.Type != NodeSection {
+		t.Fatalf("read back %+v", back)
+	}
+	for i, vt := range types {
+		if c := back.Children[i]; c.ValueType.String() != vt.String() || c.Value != "1" || c.Parent() != &back {
+			t.Errorf("child %d read back: %+v, want type %v", i, c, vt)
+		}
+	}
+	if c := back.Children[len(types)]; c.Type != NodePair || c.Value != "" {
+		t.Errorf("empty pair read back: %+v", c)
+	}
+}
+
+func TestJSONModelNewLine(t *testing.T) {
+	tests := []struct {
+		src  string
+		want interface{} // nil if omitted
+	}{
+		{"\"lang\"\n{\n}\n", nil},
+		{"\"lang\"\r\n{\r\n}\r\n", "\r\n"},
+	}
+	for _, tt := range tests {
+		v, _ := NewFromBytes([]byte(tt.src), "x_french.txt")
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := jsonMap(t, b)
+		if m["newLine"] != tt.want || m["format"] != JSONFormat || m["version"] != float64(JSONVersion) || m["file"] != "x_french.txt" {
+			t.Errorf("%q: json = %s", tt.src, b)
+		}
+
+		w := &VDFFile{}
+		if err = json.Unmarshal(b, w); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if w.Write(&out); out.String() != tt.src {
+			t.Errorf("%q read back as %q", tt.src, out.String())
+		}
+	}
+}
+
+func TestJSONModelPositions(t *testing.T) {
+	v, _ := NewFromBytes([]byte("\"lang\"\n{\n\t// note\n\t\"a\"\t\"A\"\t[$WIN32]\n}\n"), "x_french.txt")
+	b, _ := json.Marshal(v)
+	root := jsonMap(t, b)["nodes"].([]interface{})[0].(map[string]interface{})
+	pos := root["position"].(map[string]interface{})
+	if _, ok := pos["file"]; ok || pos["line"] != 1.0 || pos["column"] != 1.0 {
+		t.Errorf("position of the root = %v, want line 1 without file", pos)
+	}
+	pair := root["children"].([]interface{})[1].(map[string]interface{})
+	if pair["condition"] != "[$WIN32]" || pair["position"].(map[string]interface{})["line"] != 4.0 {
+		t.Errorf("pair = %v", pair)
+	}
+
+	// Positions without file take the file of the document, the others are kept
+	js := `{"format": "vdfloc", "version": 1, "file": "y_french.txt", "nodes": [
+		{"type": "pair", "key": "a", "value": "A", "position": {"line": 2, "column": 1, "offset": 7}},
+		{"type": "pair", "key": "b", "value": "B", "position": {"file": "inc.txt", "line": 5, "column": 3, "offset": 40}},
+		{"type": "pair", "key": "c", "value": "C"}]}`
+	w, err := ReadJSON(strings.NewReader(js), "ignored.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, _ := w.GetTree()
+	want := []string{"y_french.txt:2:1", "inc.txt:5:3", "-"}
+	for i, n := range doc.Children {
+		if got := n.Span.Start.String(); got != want[i] {
+			t.Errorf("position of %s = %s, want %s", n.Key, got, want[i])
+		}
+	}
+
+	// Node.MarshalJSON(): no file of reference, file always written
+	b, _ = doc.Children[0].MarshalJSON()
+	if pos := jsonMap(t, b)["position"].(map[string]interface{}); pos["file"] != "y_french.txt" {
+		t.Errorf("position of a node = %v", pos)
+	}
+}
+
+func TestJSONModelRejected(t *testing.T) {
+	doc := `{"type": "document", "children": [%s]}`
+	tests := []struct {
+		name string
+		json string
+		msg  string
+	}{
+		{"document in document", `{"type": "document"}`, "Node of type document nested in a document"},
+		{"pair without value", `{"type": "pair", "key": "k"}`, "Pair k without value"},
+		{"children on a pair", `{"type": "pair", "key": "k", "value": "v", "children": [{"type": "comment", "comment": "// c"}]}`, "Children in a node of type pair"},
+		{"children on a comment", `{"type": "comment", "comment": "// c", "children": []}`, ""}, // Empty: accepted
+		{"value on a section", `{"type": "section", "key": "s", "value": "v"}`, "Value in a node of type section"},
+		{"value type on a section", `{"type": "section", "key": "s", "valueType": "int32"}`, "Value in a node of type section"},
+		{"unknown type", `{"type": "array"}`, `Invalid node type "array"`},
+		{"unknown value type", `{"type": "pair", "key": "k", "value": "1", "valueType": "double"}`, `Invalid value type "double"`},
+		{"invalid condition", `{"type": "pair", "key": "k", "value": "v", "condition": "[$A&&]"}`, "Invalid conditional statement"},
+	}
+	for _, tt := range tests {
+		var n Node
+		err := json.Unmarshal([]byte(strings.Replace(doc, "%s", tt.json, 1)), &n)
+		if len(tt.msg) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var je *JSONError
+		if !errors.As(err, &je) || !strings.HasPrefix(je.Msg, tt.msg) || !strings.HasPrefix(je.Path, "$.children[0]") {
+			t.Errorf("%s: err = %v, want a *JSONError on $.children[0]: %s", tt.name, err, tt.msg)
+		}
+	}
+
+	// A document is only accepted as the node read
+	var n Node
+	if err := json.Unmarshal([]byte(`{"type": "document", "children": [{"type": "section", "key": "s"}]}`), &n); err != nil || n.Type != NodeDocument {
+		t.Errorf("document: %+v, %v", n, err)
+	}
+	_, err := ReadJSON(strings.NewReader(`{"format": "vdfloc", "version": 1, "nodes": [{"type": "document"}]}`), "x.txt")
+	var je *JSONError
+	if !errors.As(err, &je) || je.Path != "$.nodes[0]" {
+		t.Errorf("document in the nodes of a file: err = %v", err)
+	}
+}
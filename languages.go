@@ -0,0 +1,255 @@
+package vdfloc
+
+// Steam languages
+//
+// Catalog of the languages supported by Steam and helpers to go from a loc file
+// name or header to a language and back.
+// See https://partner.steamgames.com/doc/store/localization/languages
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fabdem/go-vdfloc/config"
+	"path/filepath"
+	"strings"
+)
+
+// Direction is the writing direction of a language.
+type Direction int
+
+const (
+	LeftToRight Direction = iota
+	RightToLeft
+)
+
+func (d Direction) String() string {
+	if d == RightToLeft {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// MarshalJSON serializes a direction as ltr or rtl
+func (d Direction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Language describes a Steam language.
+type Language struct {
+	Name        string    `json:"name"`              // Steam name used in loc file names and headers e.g. schinese
+	APICode     string    `json:"apiCode"`           // Steam Web API language code e.g. zh-CN
+	BCP47       string    `json:"bcp47"`             // BCP-47 tag e.g. zh-Hans
+	DisplayName string    `json:"displayName"`       // English name e.g. Simplified Chinese
+	Direction   Direction `json:"direction"`         // Writing direction
+	Plurals     int       `json:"plurals,omitempty"` // Number of plural forms, 0 if not in the plural/gender config
+	Genders     []string  `json:"genders,omitempty"` // Gender tags e.g. #|f|#, from the plural/gender config
+}
+
+// Catalog of the Steam languages - plural/gender data is added from the config on lookup
+var steamLanguages = []Language{
+	{Name: "arabic", APICode: "ar", BCP47: "ar", DisplayName: "Arabic", Direction: RightToLeft},
+	{Name: "bulgarian", APICode: "bg", BCP47: "bg", DisplayName: "Bulgarian"},
+	{Name: "schinese", APICode: "zh-CN", BCP47: "zh-Hans", DisplayName: "Simplified Chinese"},
+	{Name: "tchinese", APICode: "zh-TW", BCP47: "zh-Hant", DisplayName: "Traditional Chinese"},
+	{Name: "czech", APICode: "cs", BCP47: "cs", DisplayName: "Czech"},
+	{Name: "danish", APICode: "da", BCP47: "da", DisplayName: "Danish"},
+	{Name: "dutch", APICode: "nl", BCP47: "nl", DisplayName: "Dutch"},
+	{Name: "english", APICode: "en", BCP47: "en", DisplayName: "English"},
+	{Name: "finnish", APICode: "fi", BCP47: "fi", DisplayName: "Finnish"},
+	{Name: "french", APICode: "fr", BCP47: "fr", DisplayName: "French"},
+	{Name: "german", APICode: "de", BCP47: "de", DisplayName: "German"},
+	{Name: "greek", APICode: "el", BCP47: "el", DisplayName: "Greek"},
+	{Name: "hungarian", APICode: "hu", BCP47: "hu", DisplayName: "Hungarian"},
+	{Name: "indonesian", APICode: "id", BCP47: "id", DisplayName: "Indonesian"},
+	{Name: "italian", APICode: "it", BCP47: "it", DisplayName: "Italian"},
+	{Name: "japanese", APICode: "ja", BCP47: "ja", DisplayName: "Japanese"},
+	{Name: "koreana", APICode: "ko", BCP47: "ko", DisplayName: "Korean"},
+	{Name: "norwegian", APICode: "no", BCP47: "nb", DisplayName: "Norwegian"},
+	{Name: "polish", APICode: "pl", BCP47: "pl", DisplayName: "Polish"},
+	{Name: "portuguese", APICode: "pt", BCP47: "pt-PT", DisplayName: "Portuguese - Portugal"},
+	{Name: "brazilian", APICode: "pt-BR", BCP47: "pt-BR", DisplayName: "Portuguese - Brazil"},
+	{Name: "romanian", APICode: "ro", BCP47: "ro", DisplayName: "Romanian"},
+	{Name: "russian", APICode: "ru", BCP47: "ru", DisplayName: "Russian"},
+	{Name: "spanish", APICode: "es", BCP47: "es-ES", DisplayName: "Spanish - Spain"},
+	{Name: "latam", APICode: "es-419", BCP47: "es-419", DisplayName: "Spanish - Latin America"},
+	{Name: "swedish", APICode: "sv", BCP47: "sv", DisplayName: "Swedish"},
+	{Name: "thai", APICode: "th", BCP47: "th", DisplayName: "Thai"},
+	{Name: "turkish", APICode: "tr", BCP47: "tr", DisplayName: "Turkish"},
+	{Name: "ukrainian", APICode: "uk", BCP47: "uk", DisplayName: "Ukrainian"},
+	{Name: "vietnamese", APICode: "vn", BCP47: "vi", DisplayName: "Vietnamese"},
+}
+
+// Former Steam names still found in some loc files
+var languageAliases = map[string]string{
+	"korean": "koreana",
+}
+
+// Languages()
+//
+// Returns all the Steam languages with their plural/gender data
+// from the default config (see LoadJsonConf()).
+//
+func Languages() (list []Language) {
+	conf := defaultConf()
+	for _, l := range steamLanguages {
+		list = append(list, l.withConfig(conf))
+	}
+	return list
+}
+
+// LookupLanguage()
+//
+// Returns the Steam language matching a Steam name (e.g. koreana), a Web API code
+// (e.g. ko) or a BCP-47 tag (e.g. ko-KR), case insensitive.
+// Plural/gender data comes from the default config (see LoadJsonConf()).
+// ok == false if the language is unknown.
+//
+func LookupLanguage(name string) (lang Language, ok bool) {
+	return lookupLanguage(name, defaultConf())
+}
+
+// LookupLanguage()
+//
+// Same as LookupLanguage() with plural/gender data from the config of the instance.
+//
+func (v *VDFFile) LookupLanguage(name string) (lang Language, ok bool) {
+	return lookupLanguage(name, v.pluralGenderConfig())
+}
+
+func lookupLanguage(name string, conf *config.Config) (lang Language, ok bool) {
+	name = strings.TrimSpace(name)
+	if alias, found := languageAliases[strings.ToLower(name)]; found {
+		name = alias
+	}
+
+	for _, l := range steamLanguages { // Steam names first: "no" or "vn" aren't ambiguous that way
+		if strings.EqualFold(l.Name, name) {
+			return l.withConfig(conf), true
+		}
+	}
+	for _, l := range steamLanguages {
+		if strings.EqualFold(l.APICode, name) || strings.EqualFold(l.BCP47, name) {
+			return l.withConfig(conf), true
+		}
+	}
+
+	// BCP-47 tag with a region or script not in the catalog: e.g. fr-CA -> french
+	if i := strings.IndexAny(name, "-_"); i > 0 {
+		return lookupLanguage(name[:i], conf)
+	}
+	return lang, false
+}
+
+// withConfig returns a copy of the language with its plural/gender data
+func (l Language) withConfig(conf *config.Config) Language {
+	l.Plurals, _ = conf.GetPlural(l.Name) // Missing from the config: no data
+	l.Genders, _ = conf.GetGenders(l.Name)
+	return l
+}
+
+// defaultConf returns the plural/gender config used by default
+func defaultConf() *config.Config {
+	defaults.RLock()
+	defer defaults.RUnlock()
+	return defaults.conf
+}
+
+// LanguageFromFileName()
+//
+// Returns the language of a loc file from its name.
+// A loc file name is formed like this xxxx_<language>.yyy or <language>.yyy
+// err != nil if the name doesn't end with a Steam language name.
+//
+func LanguageFromFileName(fileName string) (lang Language, err error) {
+	_, name := splitLocFileName(fileName)
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	for _, l := range steamLanguages {
+		if l.Name == name {
+			return l.withConfig(defaultConf()), nil
+		}
+	}
+	return lang, fmt.Errorf("No Steam language found in file name %s", fileName)
+}
+
+// FileNameForLanguage()
+//
+// Returns the name of the loc file of a language corresponding to another loc file
+// (e.g. dota_english.txt -> dota_french.txt, english.txt -> french.txt).
+// The path if any is kept. If base doesn't end with a language name
+// the language is added (e.g. dota.txt -> dota_french.txt).
+//
+func FileNameForLanguage(base string, lang Language) string {
+	dir, file := filepath.Split(base)
+	ext := filepath.Ext(file)
+	prefix, _ := splitLocFileName(file)
+
+	if _, err := LanguageFromFileName(file); err != nil { // No language in the name
+		prefix = strings.TrimSuffix(file, ext)
+	}
+
+	if len(prefix) == 0 {
+		return dir + lang.Name + ext
+	}
+	return dir + prefix + "_" + lang.Name + ext
+}
+
+// splitLocFileName()
+//
+// Splits xxxx_<language>.yyy in xxxx and <language> (lower case) and <language>.yyy
+// in "" and <language>.
+//
+func splitLocFileName(fileName string) (prefix string, lang string) {
+	file := filepath.Base(fileName)
+	stem := strings.TrimSuffix(file, filepath.Ext(file))
+
+	if i := strings.LastIndex(stem, "_"); i >= 0 {
+		return stem[:i], strings.ToLower(stem[i+1:])
+	}
+	return "", strings.ToLower(stem)
+}
+
+// LanguageFromHeader()
+//
+// Returns the language declared in the header of a loc file tree, i.e. the value
+// of the "Language" key outside the tokens section:
+//	"lang"
+//	{
+//		"Language"	"french"
+//		"Tokens"
+//		{
+// err != nil if there is no declaration or if the language is unknown.
+//
+func LanguageFromHeader(doc *Node) (lang Language, err error) {
+	return languageFromHeader(doc, defaultConf())
+}
+
+// LanguageFromHeader()
+//
+// Returns the language declared in the header of the file (see LanguageFromHeader()).
+//
+func (v *VDFFile) LanguageFromHeader() (lang Language, err error) {
+	v.log(fmt.Sprintf("LanguageFromHeader()"))
+
+	doc, err := v.tree()
+	if err != nil {
+		return lang, err
+	}
+	return languageFromHeader(doc, v.pluralGenderConfig())
+}
+
+func languageFromHeader(doc *Node, conf *config.Config) (lang Language, err error) {
+	h, err := ParseHeader(doc)
+	if err != nil {
+		return lang, err
+	}
+	if !h.HasLanguage() {
+		return lang, fmt.Errorf("No language declared in the header")
+	}
+
+	if lang, ok := lookupLanguage(h.Language, conf); ok {
+		return lang, nil
+	}
+	return lang, fmt.Errorf("Unknown language %q declared in the header", h.Language)
+}
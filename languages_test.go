@@ -0,0 +1,123 @@
+package vdfloc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLookupLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // Steam name, empty if unknown
+	}{
+		// Steam names, case insensitive
+		{"french", "french"},
+		{"French", "french"},
+		{" SCHINESE ", "schinese"},
+		{"koreana", "koreana"},
+		{"korean", "koreana"}, // Former name
+		{"latam", "latam"},
+		// Steam Web API codes
+		{"zh-CN", "schinese"},
+		{"zh-tw", "tchinese"},
+		{"pt-BR", "brazilian"},
+		{"es-419", "latam"},
+		{"vn", "vietnamese"},
+		{"no", "norwegian"},
+		// BCP-47 tags
+		{"zh-Hans", "schinese"},
+		{"zh-Hant", "tchinese"},
+		{"pt-PT", "portuguese"},
+		{"es-ES", "spanish"},
+		{"nb", "norwegian"},
+		{"vi", "vietnamese"},
+		{"fr-CA", "french"},  // Region not in the catalog
+		{"de_AT", "german"},  // Underscore separator
+		{"es-MX", "spanish"}, // Not latam: only es-419 is
+		{"pt-AO", "portuguese"},
+		// Unknown
+		{"klingon", ""},
+		{"xx-FR", ""},
+		{"", ""},
+		{"-fr", ""},
+	}
+	for _, tt := range tests {
+		lang, ok := LookupLanguage(tt.name)
+		if ok != (len(tt.want) > 0) || lang.Name != tt.want {
+			t.Errorf("LookupLanguage(%q) = %q, %v, want %q", tt.name, lang.Name, ok, tt.want)
+		}
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	list := Languages()
+	if len(list) != len(steamLanguages) {
+		t.Fatalf("%d languages, want %d", len(list), len(steamLanguages))
+	}
+	seen := make(map[string]bool)
+	for _, l := range list {
+		for _, id := range []string{l.Name, l.APICode, l.BCP47} {
+			if found, ok := LookupLanguage(id); !ok || found.Name != l.Name {
+				t.Errorf("LookupLanguage(%q) = %q, want %q", id, found.Name, l.Name)
+			}
+		}
+		if seen[l.Name] || len(l.DisplayName) == 0 {
+			t.Errorf("language %+v duplicate or without display name", l)
+		}
+		seen[l.Name] = true
+	}
+
+	ar, _ := LookupLanguage("arabic")
+	if ar.Direction != RightToLeft {
+		t.Errorf("arabic written %s", ar.Direction)
+	}
+	if js, _ := json.Marshal(ar.Direction); string(js) != `"rtl"` {
+		t.Errorf("json direction = %s", js)
+	}
+	if fr, _ := LookupLanguage("french"); fr.Direction != LeftToRight || fr.Plurals == 0 {
+		t.Errorf("french = %+v, want ltr with plural forms from the default config", fr)
+	}
+}
+
+func TestLanguageFromFileName(t *testing.T) {
+	tests := []struct {
+		file string
+		want string // Steam name, empty if none
+	}{
+		{"dota_french.txt", "french"},
+		{"resource/closecaption_schinese.txt", "schinese"},
+		{"Game_FRENCH.TXT", "french"},
+		{"english.txt", "english"},
+		{"x_korean.txt", "koreana"},
+		{"my_game_latam.txt", "latam"},
+		{"dota_fr.txt", ""}, // Codes are not used in file names
+		{"dota.txt", ""},
+		{"dota_klingon.txt", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		lang, err := LanguageFromFileName(tt.file)
+		if (err == nil) != (len(tt.want) > 0) || lang.Name != tt.want {
+			t.Errorf("LanguageFromFileName(%q) = %q, %v, want %q", tt.file, lang.Name, err, tt.want)
+		}
+	}
+}
+
+func TestFileNameForLanguage(t *testing.T) {
+	fr, _ := LookupLanguage("french")
+	tests := []struct {
+		base string
+		want string
+	}{
+		{"dota_english.txt", "dota_french.txt"},
+		{"resource/dota_english.txt", "resource/dota_french.txt"},
+		{"english.txt", "french.txt"},
+		{"dota.txt", "dota_french.txt"},
+		{"my_game.txt", "my_game_french.txt"},
+	}
+	for _, tt := range tests {
+		if got := FileNameForLanguage(tt.base, fr); got != tt.want {
+			t.Errorf("FileNameForLanguage(%q) = %q, want %q", tt.base, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package vdfloc
+
+// KeyValues tokenizer
+//
+// Splits a utf8 buffer into the lexical elements of the KeyValues text format:
+// quoted and unquoted strings, braces, conditional statements and comments.
+// White spaces are not returned but each lexeme records whether a line break
+// precedes it so the parser can tell what belongs to the same line.
+
+type lexKind int
+
+const (
+	lexEOF     lexKind = iota
+	lexString          // "quoted string"
+	lexBare            // unquoted string
+	lexOpen            // {
+	lexClose           // }
+	lexCond            // [$CONDITIONAL]
+	lexComment         // // comment up to the end of the line
+)
+
+type lexeme struct {
+	kind  lexKind
+	text  string // strings: content without quotes. Others: text as written
+	start int    // offset of the first byte
+	end   int    // offset after the last byte
+	nl    bool   // a line break precedes the lexeme
+}
+
+type lexer struct {
+	buf  []byte
+	pos  int
+	errs SyntaxErrors
+}
+
+func newLexer(buf []byte) *lexer {
+	return &lexer{buf: buf}
+}
+
+// next()
+//
+// Returns the next lexeme. Returns lexEOF at the end of the buffer
+// and keeps doing so if called again.
+//
+func (l *lexer) next() (t lexeme) {
+	t.nl = l.skipSpaces()
+	t.start = l.pos
+
+	if l.pos >= len(l.buf) {
+		t.kind = lexEOF
+		t.end = l.pos
+		return t
+	}
+
+	switch c := l.buf[l.pos]; {
+	case c == '"':
+		t.kind = lexString
+		t.text = l.scanQuoted()
+	case c == '{':
+		t.kind = lexOpen
+		l.pos++
+		t.text = "{"
+	case c == '}':
+		t.kind = lexClose
+		l.pos++
+		t.text = "}"
+	case c == '[':
+		t.kind = lexCond
+		t.text = l.scanCond()
+	case c == '/' && l.pos+1 < len(l.buf) && l.buf[l.pos+1] == '/':
+		t.kind = lexComment
+		t.text = l.scanComment()
+	default:
+		t.kind = lexBare
+		t.text = l.scanBare()
+	}
+	t.end = l.pos
+	return t
+}
+
+// skipSpaces()
+//
+// Moves forward up to the next non blank character.
+// Returns true if a line break was crossed.
+//
+func (l *lexer) skipSpaces() (nl bool) {
+	for l.pos < len(l.buf) {
+		switch l.buf[l.pos] {
+		case '\n':
+			nl = true
+		case ' ', '\t', '\r', '\v', '\f':
+		default:
+			return nl
+		}
+		l.pos++
+	}
+	return nl
+}
+
+// scanQuoted()
+//
+// Reads a quoted string. Escaped characters (\x) are kept as is.
+// A quoted string can span several lines.
+//
+func (l *lexer) scanQuoted() string {
+	start := l.pos
+	l.pos++ // opening quote
+	for l.pos < len(l.buf) {
+		switch l.buf[l.pos] {
+		case '\\':
+			l.pos += 2
+			continue
+		case '"':
+			l.pos++
+			return string(l.buf[start+1 : l.pos-1])
+		}
+		l.pos++
+	}
+	l.pos = len(l.buf)
+	l.errs = append(l.errs, &SyntaxError{Pos: Position{Offset: start}, Kind: SyntaxUnterminatedString, Msg: "unterminated string", Text: string(l.buf[start:])})
+	return string(l.buf[start+1:])
+}
+
+// scanCond()
+//
+// Reads a conditional statement including its brackets.
+// A conditional statement has to be closed on the same line.
+//
+func (l *lexer) scanCond() string {
+	start := l.pos
+	for l.pos < len(l.buf) {
+		switch l.buf[l.pos] {
+		case ']':
+			l.pos++
+			return string(l.buf[start:l.pos])
+		case '\r', '\n':
+			l.errs = append(l.errs, &SyntaxError{Pos: Position{Offset: start}, Kind: SyntaxUnterminatedCond, Msg: "unterminated conditional statement", Text: string(l.buf[start:l.pos])})
+			return string(l.buf[start:l.pos])
+		}
+		l.pos++
+	}
+	l.errs = append(l.errs, &SyntaxError{Pos: Position{Offset: start}, Kind: SyntaxUnterminatedCond, Msg: "unterminated conditional statement", Text: string(l.buf[start:l.pos])})
+	return string(l.buf[start:l.pos])
+}
+
+// scanComment()
+//
+// Reads a comment up to the end of the line (line break excluded).
+//
+func (l *lexer) scanComment() string {
+	start := l.pos
+	for l.pos < len(l.buf) && l.buf[l.pos] != '\n' {
+		l.pos++
+	}
+	if l.pos > start && l.buf[l.pos-1] == '\r' {
+		l.pos-- // the carriage return is part of the line break
+	}
+	return string(l.buf[start:l.pos])
+}
+
+// scanBare()
+//
+// Reads an unquoted string. It ends with a blank, a quote, a brace or a comment.
+//
+func (l *lexer) scanBare() string {
+	start := l.pos
+	for l.pos < len(l.buf) {
+		switch c := l.buf[l.pos]; c {
+		case ' ', '\t', '\r', '\n', '\v', '\f', '"', '{', '}':
+			return string(l.buf[start:l.pos])
+		case '/':
+			if l.pos+1 < len(l.buf) && l.buf[l.pos+1] == '/' {
+				return string(l.buf[start:l.pos])
+			}
+		}
+		l.pos++
+	}
+	return string(l.buf[start:l.pos])
+}
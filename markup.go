@@ -0,0 +1,210 @@
+package vdfloc
+
+// Markup validation of token values
+//
+// Values may hold html like markup e.g. <b>, <font color="#FF0000">, <br>.
+// A broken tag corrupts the display of the string in game.
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tag is a markup tag found in a value.
+type Tag struct {
+	Name    string // Lower case name e.g. font
+	Text    string // As written e.g. <font color="#FF0000">
+	Closing bool   // </name>
+	Empty   bool   // <name/> or a void tag e.g. <br>: no closing tag expected
+	Offset  int    // Byte offset in the value
+}
+
+var reTag = regexp.MustCompile(`<\s*(/?)\s*([a-zA-Z][a-zA-Z0-9]*)((?:\s[^<>]*?)?)\s*(/?)\s*>`)
+
+// Tags that are never closed
+var voidTags = map[string]bool{"br": true, "hr": true, "img": true}
+
+// DefaultAllowedTags()
+//
+// Returns the markup tags accepted by default (see Options.AllowedTags).
+//
+func DefaultAllowedTags() []string {
+	return []string{"a", "b", "br", "div", "em", "font", "h1", "h2", "h3", "hr", "i", "img", "li", "ol", "p", "s", "span", "strike", "strong", "sub", "sup", "u", "ul"}
+}
+
+// MarkupTags()
+//
+// Returns the markup tags of a value in order of appearance.
+//
+func MarkupTags(value string) (list []Tag) {
+	for _, m := range reTag.FindAllStringSubmatchIndex(value, -1) {
+		name := strings.ToLower(value[m[4]:m[5]])
+		list = append(list, Tag{
+			Name:    name,
+			Text:    value[m[0]:m[1]],
+			Closing: m[3] > m[2],
+			Empty:   m[9] > m[8] || voidTags[name],
+			Offset:  m[0],
+		})
+	}
+	return list
+}
+
+// CheckMarkup()
+//
+// Check the markup of a token value:
+//	- tags opened and not closed, closed and not opened (error)
+//	- tags closed in the wrong order e.g. <b><i></b></i> (error)
+//	- tags not in the allow-list (warning, see Options.AllowedTags)
+// err != nil only in case of processing failure.
+//
+func (v *VDFFile) CheckMarkup(t Token) (diags Diagnostics, err error) {
+	// v.log(fmt.Sprintf("CheckMarkup(%s, %s)", t.Key, t.Value)) remove log out of concerns about performance impact
+
+	allowed := v.allowedTagList()
+	if allowed == nil {
+		allowed = DefaultAllowedTags()
+	}
+
+	var open []Tag // stack of the tags opened
+	for _, tag := range MarkupTags(t.Value) {
+		if !containsFold(allowed, tag.Name) {
+			msg := fmt.Sprintf("Unknown markup tag %s", tag.Text)
+			diags = append(diags, v.tagDiag(t, tag, SeverityWarning, msg, ""))
+		}
+
+		switch {
+		case tag.Closing && voidTags[tag.Name]:
+			// </br> is tolerated
+		case tag.Empty:
+		case !tag.Closing:
+			open = append(open, tag)
+		case len(open) == 0 || !tagOpened(open, tag.Name):
+			msg := fmt.Sprintf("Closing tag %s without opening tag", tag.Text)
+			diags = append(diags, v.tagDiag(t, tag, SeverityError, msg, "Remove the tag or add the opening tag."))
+		default:
+			last := open[len(open)-1]
+			if last.Name != tag.Name { // closes an outer tag: inner ones are left open
+				msg := fmt.Sprintf("Closing tag %s found while %s is still open", tag.Text, last.Text)
+				diags = append(diags, v.tagDiag(t, tag, SeverityError, msg, fmt.Sprintf("Close %s first.", last.Text)))
+			}
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i].Name == tag.Name {
+					open = append(open[:i], open[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+
+	for _, tag := range open {
+		msg := fmt.Sprintf("Tag %s is not closed", tag.Text)
+		diags = append(diags, v.tagDiag(t, tag, SeverityError, msg, fmt.Sprintf("Add </%s>.", tag.Name)))
+	}
+	return diags, nil
+}
+
+// CompareMarkup()
+//
+// Check that a token value holds the same markup tags as its english source value
+// (attributes are not compared).
+// err != nil only in case of processing failure.
+//
+func (v *VDFFile) CompareMarkup(t Token, source string) (diags Diagnostics, err error) {
+	count := make(map[string]int)
+	for _, tag := range MarkupTags(source) {
+		count[tagKey(tag)]++
+	}
+	for _, tag := range MarkupTags(t.Value) {
+		count[tagKey(tag)]--
+	}
+
+	var missing, extra []string
+	for k, n := range count {
+		for ; n > 0; n-- {
+			missing = append(missing, k)
+		}
+		for ; n < 0; n++ {
+			extra = append(extra, k)
+		}
+	}
+	if len(missing)+len(extra) == 0 {
+		return diags, nil
+	}
+
+	sort.Strings(missing)
+	sort.Strings(extra)
+	msg := "Markup differs from the source:"
+	if len(missing) > 0 {
+		msg += " missing " + strings.Join(missing, " ")
+	}
+	if len(extra) > 0 {
+		msg += " extra " + strings.Join(extra, " ")
+	}
+	diags = append(diags, newDiagnostic(RuleMarkup, SeverityWarning, t, msg, ""))
+	return diags, nil
+}
+
+// CheckMarkupWithSource()
+//
+// Check the markup of all the tokens (see CheckMarkup()) and compare it
+// with their source value (see CompareMarkup() and CheckPlaceholdersWithSource()).
+// en may be nil.
+//
+func (v *VDFFile) CheckMarkupWithSource(en *VDFFile) (diags Diagnostics, err error) {
+	v.log(fmt.Sprintf("CheckMarkupWithSource()"))
+
+	doc, err := v.tree()
+	if err != nil {
+		return diags, err
+	}
+	for _, n := range tokenPairs(doc) {
+		d, _ := v.CheckMarkup(tokenFromNode(n))
+		diags = append(diags, d...)
+	}
+
+	d, err := v.checkWithSource(en, v.CompareMarkup)
+	if err != nil {
+		return diags, err
+	}
+	diags = append(diags, d...)
+	diags.Sort()
+	return diags, nil
+}
+
+// tagDiag returns a diagnostic located on a tag of a token value
+func (v *VDFFile) tagDiag(t Token, tag Tag, sev Severity, msg string, fix string) Diagnostic {
+	d := newDiagnostic(RuleMarkup, sev, t, msg, fix)
+	d.Span = t.valueSpan(tag.Offset, tag.Offset+len(tag.Text))
+	return d
+}
+
+// tagKey returns the tag without attributes e.g. <font> or </font>
+func tagKey(tag Tag) string {
+	if tag.Closing {
+		return "</" + tag.Name + ">"
+	}
+	return "<" + tag.Name + ">"
+}
+
+// tagOpened returns true if a tag is in the stack of opened tags
+func tagOpened(open []Tag, name string) bool {
+	for _, t := range open {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold returns true if a list holds a string, case insensitive
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+	return false
+}
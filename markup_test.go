@@ -0,0 +1,130 @@
+package vdfloc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkupTags(t *testing.T) {
+	var got []string
+	for _, tag := range MarkupTags(`<B>a</ b><font color="#FF0000">c</font><br><img src="x"/> < b >`) {
+		s := tag.Name
+		if tag.Closing {
+			s = "/" + s
+		}
+		if tag.Empty {
+			s += "/"
+		}
+		got = append(got, s)
+	}
+	if want := "b /b font /font br/ img/ b"; strings.Join(got, " ") != want {
+		t.Errorf("MarkupTags() = %s, want %s", strings.Join(got, " "), want)
+	}
+	if tags := MarkupTags("1 < 2 and 3 > 2"); len(tags) != 0 {
+		t.Errorf("comparison taken for tags: %v", tags)
+	}
+}
+
+func TestCheckMarkup(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string // Severity and start of the message of each diagnostic
+	}{
+		{"<b>bold</b> <i>it</i><br>line", ""},
+		{`<font color="#FF0000">red</FONT>`, ""},
+		{"a</br>b", ""}, // Tolerated
+		{"<b>not closed", "error Tag <b> is not closed"},
+		{"closed</b>", "error Closing tag </b> without"},
+		{"<b><i>x</b></i>", "error Closing tag </b> found while <i>"}, // </i> still closes <i>,
+		{"<blink>x</blink>", "warning Unknown markup tag <blink>|warning Unknown markup tag </blink>"},
+		{"<b><blink>x</b>", "warning Unknown markup tag <blink>|error Closing tag </b> found|error Tag <blink> is not closed"},
+	}
+	v := &VDFFile{}
+	for _, tt := range tests {
+		diags, err := v.CheckMarkup(Token{Key: "k", Value: tt.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := strings.Split(tt.want, "|")
+		if len(tt.want) == 0 {
+			want = nil
+		}
+		if len(diags) != len(want) {
+			t.Errorf("CheckMarkup(%q) = %v, want %s", tt.value, diags, tt.want)
+			continue
+		}
+		for i, d := range diags {
+			if got := d.Severity.String() + " " + d.Message; d.Rule != RuleMarkup || d.Key != "k" || !strings.HasPrefix(got, want[i]) {
+				t.Errorf("CheckMarkup(%q) diagnostic %d = %s, want %s", tt.value, i, got, want[i])
+			}
+		}
+	}
+}
+
+func TestCheckMarkupAllowedTags(t *testing.T) {
+	tok := Token{Key: "k", Value: "<blink>x</blink> <b>y</b>"}
+
+	v, _ := NewFromBytes(nil, "x_french.txt", Options{AllowedTags: []string{"BLINK"}})
+	if diags, _ := v.CheckMarkup(tok); len(diags) != 2 || !strings.Contains(diags[0].Message, "<b>") {
+		t.Errorf("allowed blink only: %v, want <b> and </b> unknown", diags)
+	}
+
+	v.SetAllowedTags(nil)
+	if diags, _ := v.CheckMarkup(tok); len(diags) != 2 || !strings.Contains(diags[0].Message, "<blink>") {
+		t.Errorf("default tags: %v, want <blink> and </blink> unknown", diags)
+	}
+
+	v.SetAllowedTags([]string{})
+	if diags, _ := v.CheckMarkup(tok); len(diags) != 4 {
+		t.Errorf("no tag allowed: %v, want 4 unknown tags", diags)
+	}
+}
+
+func TestCompareMarkup(t *testing.T) {
+	tests := []struct {
+		value  string
+		source string
+		want   string // Message, empty if none
+	}{
+		{`<font color="red">Rouge</font>`, `<font color="#FF0000">Red</font>`, ""}, // Attributes not compared
+		{"<i>b</i> a<br>", "a<br> <i>b</i>", ""},                                   // Nor the order
+		{"Gras", "<b>Bold</b>", "Markup differs from the source: missing </b> <b>"},
+		{"<b>Gras</b><br>", "Bold", "Markup differs from the source: extra </b> <b> <br>"},
+		{"<i>Gras</i>", "<b>Bold</b>", "Markup differs from the source: missing </b> <b> extra </i> <i>"},
+	}
+	v := &VDFFile{}
+	for _, tt := range tests {
+		diags, err := v.CompareMarkup(Token{Key: "k", Value: tt.value}, tt.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if len(diags) > 0 {
+			got = diags[0].Message
+		}
+		if len(diags) > 1 || got != tt.want || (len(diags) == 1 && diags[0].Severity != SeverityWarning) {
+			t.Errorf("CompareMarkup(%q, %q) = %v, want %q", tt.value, tt.source, diags, tt.want)
+		}
+	}
+}
+
+func TestCheckMarkupWithSource(t *testing.T) {
+	en, _ := NewFromBytes([]byte("\"lang\"\n{\n\t\"Tokens\"\n\t{\n\t\t\"a\"\t\"<b>Bold</b>\"\n\t\t\"b\"\t\"Plain\"\n\t}\n}\n"), "x_english.txt")
+	loc, _ := NewFromBytes([]byte("\"lang\"\n{\n\t\"Tokens\"\n\t{\n\t\t\"a\"\t\"Gras\"\n\t\t\"b\"\t\"x <i>Simple\"\n\t}\n}\n"), "x_french.txt")
+	diags, err := loc.CheckMarkupWithSource(en)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.Key+" "+d.Span.Start.String())
+	}
+	// b: unclosed tag located on the tag, then the tags differing from the source
+	if want := "a x_french.txt:5:3 b x_french.txt:6:3 b x_french.txt:6:10"; strings.Join(got, " ") != want {
+		t.Errorf("CheckMarkupWithSource() = %s\nwant %s", strings.Join(got, " "), want)
+	}
+
+	if diags, _ = loc.CheckMarkupWithSource(nil); len(diags) != 1 || diags[0].Key != "b" {
+		t.Errorf("without source: %v, want the unclosed tag of b", diags)
+	}
+}
@@ -0,0 +1,159 @@
+package vdfloc
+
+// Building, navigating and editing KeyValues trees
+//
+// Any KeyValues file can be loaded in a tree: loc files, resource files (.res),
+// gameinfo.txt, items_game.txt, etc. Sections can be nested at any depth.
+//
+// Nodes created with these functions have no source text: the writer
+// generates them using the line breaks and indentation of their neighbours.
+
+import (
+	"strings"
+)
+
+// NewPair()
+//
+// Returns a new key/value pair. Key and value are written as is:
+// escape sequences have to be present already.
+//
+func NewPair(key, value string) *Node {
+	return &Node{Type: NodePair, Key: key, Value: value}
+}
+
+// NewSection()
+//
+// Returns a new empty section.
+//
+func NewSection(name string) *Node {
+	return &Node{Type: NodeSection, Key: name}
+}
+
+// NewComment()
+//
+// Returns a new comment line. // is added if missing.
+//
+func NewComment(text string) *Node {
+	return &Node{Type: NodeComment, Comment: formatComment(text)}
+}
+
+// Append()
+//
+// Add children at the end of a section or document.
+//
+func (n *Node) Append(children ...*Node) {
+	for _, c := range children {
+		n.add(c)
+	}
+}
+
+// Insert()
+//
+// Insert a child at index i of a section or document. i is clamped to the valid range.
+//
+func (n *Node) Insert(i int, child *Node) {
+	if i < 0 {
+		i = 0
+	}
+	if i > len(n.Children) {
+		i = len(n.Children)
+	}
+	child.parent = n
+	n.Children = append(n.Children, nil)
+	copy(n.Children[i+1:], n.Children[i:])
+	n.Children[i] = child
+}
+
+// Remove()
+//
+// Remove a child from a section or document. Returns false if child doesn't belong to n.
+//
+func (n *Node) Remove(child *Node) bool {
+	i := n.IndexOf(child)
+	if i < 0 {
+		return false
+	}
+	n.Children = append(n.Children[:i], n.Children[i+1:]...)
+	child.parent = nil
+	return true
+}
+
+// IndexOf()
+//
+// Returns the index of a child or -1 if child doesn't belong to n.
+//
+func (n *Node) IndexOf(child *Node) int {
+	for i, c := range n.Children {
+		if c == child {
+			return i
+		}
+	}
+	return -1
+}
+
+// Child()
+//
+// Returns the first child (section or pair) with a given key, case insensitive
+// as in the game, nil if none or if n is nil (so that calls can be chained).
+//
+func (n *Node) Child(key string) *Node {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.Children {
+		if c.Type != NodeComment && strings.EqualFold(c.Key, key) {
+			return c
+		}
+	}
+	return nil
+}
+
+// ChildrenNamed()
+//
+// Returns all the children (sections or pairs) with a given key, case insensitive.
+//
+func (n *Node) ChildrenNamed(key string) (list []*Node) {
+	for _, c := range n.Children {
+		if c.Type != NodeComment && strings.EqualFold(c.Key, key) {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+// Find()
+//
+// Returns the node at the end of a path of keys starting from n, nil if there is none.
+// E.g. doc.Find("lang", "Tokens") or doc.Find("Resource/UI.res", "ButtonOk", "xpos")
+//
+func (n *Node) Find(path ...string) *Node {
+	for _, key := range path {
+		if n = n.Child(key); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// Get()
+//
+// Returns the value of the pair at the end of a path of keys (see Find()).
+// ok == false if there is no such pair.
+//
+func (n *Node) Get(path ...string) (value string, ok bool) {
+	if p := n.Find(path...); p != nil && p.Type == NodePair {
+		return p.Value, true
+	}
+	return "", false
+}
+
+// Depth()
+//
+// Returns the number of sections holding the node: 0 for the children of the document.
+//
+func (n *Node) Depth() (depth int) {
+	for p := n.parent; p != nil && p.Type != NodeDocument; p = p.parent {
+		depth++
+	}
+	return depth
+}
@@ -0,0 +1,365 @@
+package vdfloc
+
+// KeyValues recursive descent parser
+//
+// Builds a tree of Nodes out of the lexemes returned by the tokenizer:
+//
+//	document := item* EOF
+//	item     := comment | pair | section
+//	pair     := key value [cond] [comment]
+//	section  := key [cond] '{' item* '}'
+//
+// The parser never stops on a syntax error. Errors are collected and
+// the parser resynchronises on the next lexeme so that a tree is always returned.
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NodeType identifies the kind of element held by a Node.
+type NodeType int
+
+const (
+	NodeDocument NodeType = iota // Root of a parsed buffer
+	NodeSection                  // "name" { ... }
+	NodePair                     // "key" "value"
+	NodeComment                  // Comment on its own line
+)
+
+// Node is an element of a KeyValues tree.
+// Keys and values are stored as written in the file (escape sequences are not decoded).
+type Node struct {
+	Type      NodeType
+	Key       string    // Key of a pair or name of a section
+	Value     string    // Value of a pair
+	ValueType ValueType // Type of the value in binary KeyValues, 0 (string) for text files
+	Cond      string    // Conditional statement with its brackets e.g. [$WIN32]
+	Comment   string    // Trailing comment of a pair or text of a comment node, // included
+	Children  []*Node   // Content of a section or of the document
+	Span      Span      // Source text covered by the node
+
+	parent *Node
+	open   int      // sections: offset after the opening brace
+	raw    *nodeRaw // source text, nil if the node wasn't parsed
+}
+
+// nodeRaw keeps the text of a parsed node as written in the source
+// so that it can be written back unchanged (see writer.go).
+// Blanks hold whatever lies between two pieces: spaces, line breaks and text skipped on syntax errors.
+type nodeRaw struct {
+	lead      string // Blanks before the node
+	key       string // Key with its quotes
+	condSep   string // Blanks before the conditional statement
+	cond      string
+	valueSep  string // Blanks before the value (pairs) or the opening brace (sections)
+	value     string // Value with its quotes (pairs) or opening brace (sections)
+	commSep   string // Blanks before the trailing comment
+	comment   string
+	closeLead string // Blanks before the closing brace (sections) or the end of the file (document)
+	close     string // Closing brace, empty if missing
+	nl        string // Document: line break used in the file
+
+	// Parsed content: a piece is written as is only if the matching field of the node is unchanged
+	origKey, origValue, origCond, origComment string
+}
+
+// SyntaxErrKind identifies the kind of a syntax error.
+type SyntaxErrKind int
+
+const (
+	SyntaxUnterminatedString SyntaxErrKind = iota // Missing closing double quote
+	SyntaxUnterminatedCond                        // Missing closing bracket
+	SyntaxIsolatedCond                            // Conditional statement not following a value
+	SyntaxMissingValue                            // Key without value
+	SyntaxMissingName                             // Section without name
+	SyntaxUnexpectedClose                         // Closing brace without opening one
+	SyntaxUnclosedSection                         // Missing closing brace
+)
+
+// SyntaxError reports a KeyValues syntax error.
+type SyntaxError struct {
+	Pos  Position      // Position of the offending text
+	Kind SyntaxErrKind // Kind of error
+	Msg  string        // Description
+	Text string        // Offending text
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// SyntaxErrors is the list of syntax errors found while parsing a buffer.
+type SyntaxErrors []*SyntaxError
+
+func (l SyntaxErrors) Error() string {
+	switch len(l) {
+	case 0:
+		return "no syntax error"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more syntax errors)", l[0].Error(), len(l)-1)
+}
+
+type parser struct {
+	lx     *lexer
+	tok    lexeme // lexeme read ahead
+	peeked bool
+	mark   int // offset up to which the source text has been stored in nodes
+	errs   SyntaxErrors
+}
+
+// Parse()
+//
+// Parse a utf8 buffer (use ReadSource() to decode a file) into a KeyValues tree.
+// The tree is always returned. err != nil lists the syntax errors (type SyntaxErrors)
+// in which case the tree holds whatever could be recovered.
+//
+func Parse(buf []byte) (doc *Node, err error) {
+	return ParseFile("", buf)
+}
+
+// ParseFile()
+//
+// Same as Parse(). The file name is only used to fill in the positions.
+//
+func ParseFile(name string, buf []byte) (doc *Node, err error) {
+	p := &parser{lx: newLexer(buf)}
+
+	doc = &Node{Type: NodeDocument, raw: &nodeRaw{nl: "\n"}}
+	doc.Span.End.Offset = len(buf)
+	if bytes.Contains(buf, []byte("\r\n")) {
+		doc.raw.nl = "\r\n"
+	}
+	p.parseItems(doc)
+	doc.raw.closeLead = string(buf[p.mark:])
+
+	// Convert offsets to positions
+	lt := newLineTable(name, buf)
+	doc.Walk(func(n *Node) bool {
+		n.Span = lt.span(n.Span.Start.Offset, n.Span.End.Offset)
+		return true
+	})
+
+	errs := append(p.lx.errs, p.errs...)
+	for _, e := range errs {
+		e.Pos = lt.position(e.Pos.Offset)
+	}
+	if len(errs) > 0 {
+		sortSyntaxErrors(errs)
+		return doc, errs
+	}
+	return doc, nil
+}
+
+func (p *parser) next() lexeme {
+	if p.peeked {
+		p.peeked = false
+		return p.tok
+	}
+	return p.lx.next()
+}
+
+func (p *parser) peek() lexeme {
+	if !p.peeked {
+		p.tok = p.lx.next()
+		p.peeked = true
+	}
+	return p.tok
+}
+
+// src()
+//
+// Returns the blanks between the text already stored and a lexeme, and the lexeme text.
+// The lexeme is then considered stored.
+//
+func (p *parser) src(t lexeme) (blanks string, text string) {
+	blanks, text = string(p.lx.buf[p.mark:t.start]), string(p.lx.buf[t.start:t.end])
+	p.mark = t.end
+	return blanks, text
+}
+
+func (p *parser) errorf(t lexeme, kind SyntaxErrKind, format string, a ...interface{}) {
+	p.errs = append(p.errs, &SyntaxError{Pos: Position{Offset: t.start}, Kind: kind, Msg: fmt.Sprintf(format, a...), Text: string(p.lx.buf[t.start:t.end])})
+}
+
+// parseItems()
+//
+// Parse the content of the document or of a section up to the end of the buffer
+// or the closing brace of the section.
+//
+func (p *parser) parseItems(parent *Node) {
+	for {
+		t := p.next()
+		switch t.kind {
+		case lexEOF:
+			if parent.Type == NodeSection {
+				p.errorf(t, SyntaxUnclosedSection, "missing closing brace for section %q", parent.Key)
+				parent.Span.End.Offset = t.end
+			}
+			return
+		case lexClose:
+			if parent.Type == NodeSection {
+				parent.Span.End.Offset = t.end
+				parent.raw.closeLead, parent.raw.close = p.src(t)
+				return
+			}
+			p.errorf(t, SyntaxUnexpectedClose, "unexpected closing brace")
+		case lexComment:
+			n := &Node{Type: NodeComment, Comment: t.text, Span: offsetSpan(t.start, t.end), raw: &nodeRaw{origComment: t.text}}
+			n.raw.lead, n.raw.comment = p.src(t)
+			parent.add(n)
+		case lexCond:
+			p.errorf(t, SyntaxIsolatedCond, "isolated conditional statement %s", t.text)
+		case lexOpen:
+			p.errorf(t, SyntaxMissingName, "section without name")
+			n := &Node{Type: NodeSection, Span: offsetSpan(t.start, t.end), open: t.end, raw: &nodeRaw{}}
+			n.raw.lead, n.raw.value = p.src(t)
+			parent.add(n)
+			p.parseItems(n)
+		case lexString, lexBare:
+			p.parseKeyed(parent, t)
+		}
+	}
+}
+
+// parseKeyed()
+//
+// Parse a pair or a section once its key has been read.
+//
+func (p *parser) parseKeyed(parent *Node, key lexeme) {
+	n := &Node{Key: key.text, Span: offsetSpan(key.start, key.end), raw: &nodeRaw{origKey: key.text}}
+	n.raw.lead, n.raw.key = p.src(key)
+	parent.add(n)
+	defer func() { // Keep track of the parsed content
+		n.raw.origValue, n.raw.origCond, n.raw.origComment = n.Value, n.Cond, n.Comment
+	}()
+
+	t := p.peek()
+
+	// Optional conditional statement between a section name and its opening brace
+	if t.kind == lexCond && !t.nl {
+		p.next()
+		if p.peek().kind != lexOpen {
+			p.errorf(t, SyntaxIsolatedCond, "isolated conditional statement %s", t.text)
+			n.Type = NodePair
+			p.errorf(key, SyntaxMissingValue, "key %q without value", key.text)
+			return
+		}
+		n.Cond = t.text
+		n.raw.condSep, n.raw.cond = p.src(t)
+		t = p.peek()
+	}
+
+	switch t.kind {
+	case lexOpen:
+		p.next()
+		n.Type = NodeSection
+		n.open = t.end
+		n.raw.valueSep, n.raw.value = p.src(t)
+		p.parseItems(n)
+		return
+	case lexString, lexBare:
+		p.next()
+		n.Type = NodePair
+		n.Value = t.text
+		n.Span.End.Offset = t.end
+		n.raw.valueSep, n.raw.value = p.src(t)
+	default:
+		n.Type = NodePair
+		p.errorf(key, SyntaxMissingValue, "key %q without value", key.text)
+		return
+	}
+
+	// Optional conditional statement and comment on the same line as the value
+	if t = p.peek(); t.kind == lexCond && !t.nl {
+		p.next()
+		n.Cond = t.text
+		n.Span.End.Offset = t.end
+		n.raw.condSep, n.raw.cond = p.src(t)
+	}
+	if t = p.peek(); t.kind == lexComment && !t.nl {
+		p.next()
+		n.Comment = t.text
+		n.Span.End.Offset = t.end
+		n.raw.commSep, n.raw.comment = p.src(t)
+	}
+}
+
+func (n *Node) add(child *Node) {
+	child.parent = n
+	n.Children = append(n.Children, child)
+}
+
+// Parent()
+//
+// Returns the section or document holding the node. nil for a document.
+//
+func (n *Node) Parent() *Node {
+	return n.parent
+}
+
+// Walk()
+//
+// Visit the node and its descendants depth first in document order.
+// Children of a node are skipped if fn returns false.
+//
+func (n *Node) Walk(fn func(*Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, c := range n.Children {
+		c.Walk(fn)
+	}
+}
+
+// Pairs()
+//
+// Returns all the key/value pairs under the node in document order.
+//
+func (n *Node) Pairs() (list []*Node) {
+	n.Walk(func(c *Node) bool {
+		if c.Type == NodePair {
+			list = append(list, c)
+		}
+		return true
+	})
+	return list
+}
+
+// Sections()
+//
+// Returns all the sections under the node in document order.
+//
+func (n *Node) Sections() (list []*Node) {
+	n.Walk(func(c *Node) bool {
+		if c.Type == NodeSection {
+			list = append(list, c)
+		}
+		return true
+	})
+	return list
+}
+
+// isSourceKey returns true for the keys holding the english source in loc files
+func isSourceKey(key string) bool {
+	return strings.HasPrefix(key, "[english]")
+}
+
+// offsetSpan returns a span only made of byte offsets, positions are computed once parsing is done
+func offsetSpan(start, end int) Span {
+	return Span{Start: Position{Offset: start}, End: Position{Offset: end}}
+}
+
+// sortSyntaxErrors sorts errors by line and column, errors at the same place keeping their order
+func sortSyntaxErrors(l SyntaxErrors) {
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].Pos.Line != l[j].Pos.Line {
+			return l[i].Pos.Line < l[j].Pos.Line
+		}
+		return l[i].Pos.Column < l[j].Pos.Column
+	})
+}
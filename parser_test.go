@@ -0,0 +1,186 @@
+package vdfloc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const locFile = `"lang"
+{
+	"Language"	"french"
+	"Tokens"
+	{
+		// A comment
+		"a"	"Bonjour"	[$WIN32]	// Trailing comment
+		"b"	"Ligne 1
+Ligne 2 \"quoted\""
+
+		"[english]c"	"C"
+		"c"	"C fr"
+		bare	value
+	}
+}
+`
+
+// pair returns the first pair named key under n, nil if none
+func pair(n *Node, key string) *Node {
+	for _, p := range n.Pairs() {
+		if p.Key == key {
+			return p
+		}
+	}
+	return nil
+}
+
+func TestParseLocFile(t *testing.T) {
+	doc, err := ParseFile("x_french.txt", []byte(locFile))
+	if err != nil {
+		t.Fatalf("ParseFile(): %v", err)
+	}
+
+	sections := doc.Sections()
+	if len(sections) != 2 || sections[0].Key != "lang" || sections[1].Key != "Tokens" {
+		t.Fatalf("sections = %+v, want lang and Tokens", sections)
+	}
+	tokens := sections[1]
+	if tokens.Parent() != sections[0] || sections[0].Parent() != doc {
+		t.Errorf("wrong parents")
+	}
+	if l := pair(doc, "Language"); l == nil || l.Value != "french" || l.Parent() != sections[0] {
+		t.Errorf("Language = %+v", l)
+	}
+
+	a := pair(tokens, "a")
+	if a.Value != "Bonjour" || a.Cond != "[$WIN32]" || a.Comment != "// Trailing comment" {
+		t.Errorf("a = %q %q %q", a.Value, a.Cond, a.Comment)
+	}
+	if a.Span.Start.Line != 7 || a.Span.Start.Column != 3 || a.Span.Start.File != "x_french.txt" {
+		t.Errorf("a starts at %s, want x_french.txt:7:3", a.Span.Start)
+	}
+
+	b := pair(tokens, "b")
+	if want := "Ligne 1\nLigne 2 \\\"quoted\\\""; b.Value != want {
+		t.Errorf("b = %q, want %q (multi-line value, escapes kept)", b.Value, want)
+	}
+	if b.Span.Start.Line != 8 || b.Span.End.Line != 9 {
+		t.Errorf("b spans lines %d-%d, want 8-9", b.Span.Start.Line, b.Span.End.Line)
+	}
+
+	if bare := pair(tokens, "bare"); bare == nil || bare.Value != "value" {
+		t.Errorf("bare = %+v", bare)
+	}
+
+	var keys []string
+	for _, n := range tokens.Pairs() {
+		keys = append(keys, n.Key)
+	}
+	if got := strings.Join(keys, " "); got != "a b [english]c c bare" {
+		t.Errorf("Pairs() = %s, want a b [english]c c bare", got)
+	}
+	if c := tokens.Children[0]; c.Type != NodeComment || c.Comment != "// A comment" {
+		t.Errorf("first child = %+v, want the comment", c)
+	}
+}
+
+func TestParseNestedSections(t *testing.T) {
+	src := `"Resource/UI.res"
+{
+	"Button" [$WIN32]
+	{
+		"xpos"	"10"
+		"Sub"
+		{
+			"Deep"
+			{
+				"k"	"v"
+			}
+		}
+	}
+	"Label" { "text" "#Hello" }
+}
+`
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse(): %v", err)
+	}
+	sections := doc.Sections()
+	if n := len(sections); n != 5 {
+		t.Fatalf("%d sections, want 5", n)
+	}
+	if button := sections[1]; button.Key != "Button" || button.Cond != "[$WIN32]" {
+		t.Errorf("Button = %+v", button)
+	}
+	k := doc.Find("Resource/UI.res", "button", "sub", "deep", "k") // Case insensitive
+	if k == nil || k.Value != "v" || k.Depth() != 4 {
+		t.Fatalf("k = %+v", k)
+	}
+	if k.Parent().Parent().Key != "Sub" {
+		t.Errorf("parent of Deep = %s", k.Parent().Parent().Key)
+	}
+	if v, _ := doc.Get("Resource/UI.res", "Label", "text"); v != "#Hello" {
+		t.Errorf("Label/text = %q", v)
+	}
+}
+
+func TestParseSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		kind SyntaxErrKind
+		line int
+	}{
+		{"unterminated string", "\"lang\"\n{\n\t\"a\"\t\"open\n}\n", SyntaxUnterminatedString, 3},
+		{"unterminated cond", "\"a\"\t\"b\"\t[$WIN32\n", SyntaxUnterminatedCond, 1},
+		{"isolated cond", "\"s\"\n{\n[$X]\n}\n", SyntaxIsolatedCond, 3},
+		{"missing value", "\"s\"\n{\n\t\"a\"\n}\n", SyntaxMissingValue, 3},
+		{"section without name", "{\n\t\"a\" \"b\"\n}\n", SyntaxMissingName, 1},
+		{"unexpected close", "\"a\" \"b\"\n}\n", SyntaxUnexpectedClose, 2},
+		{"unclosed section", "\"s\"\n{\n\t\"a\" \"b\"\n", SyntaxUnclosedSection, 4},
+	}
+	for _, tt := range tests {
+		doc, err := Parse([]byte(tt.src))
+		if doc == nil {
+			t.Errorf("%s: no tree returned", tt.name)
+			continue
+		}
+		var errs SyntaxErrors
+		if !errors.As(err, &errs) || len(errs) == 0 {
+			t.Errorf("%s: err = %v, want SyntaxErrors", tt.name, err)
+			continue
+		}
+		if errs[0].Kind != tt.kind || errs[0].Pos.Line != tt.line {
+			t.Errorf("%s: got %v (kind %d), want kind %d on line %d", tt.name, errs[0], errs[0].Kind, tt.kind, tt.line)
+		}
+		// The tree is still written back as read
+		if got := string(doc.Bytes()); got != tt.src {
+			t.Errorf("%s: Bytes() = %q, want %q", tt.name, got, tt.src)
+		}
+	}
+}
+
+func TestParseRecovers(t *testing.T) {
+	// The pairs following an error are still read
+	doc, err := Parse([]byte("\"s\"\n{\n\t\"a\"\n\t}\n\t\"b\"\t\"B\"\n}\n\"t\" { \"c\" \"C\" }\n"))
+	if err == nil {
+		t.Fatal("no syntax error")
+	}
+	if c := pair(doc, "c"); c == nil || c.Value != "C" || c.Parent().Key != "t" {
+		t.Errorf("t/c = %+v", c)
+	}
+}
+
+func TestSyntaxErrorsSorted(t *testing.T) {
+	// Lexer and parser errors are merged in source order
+	_, err := Parse([]byte("\"s\"\n{\n\t\"a\"\n\t\"b\"\t\"c\"\t[$X\n\t\"d\"\n}\n"))
+	var errs SyntaxErrors
+	if !errors.As(err, &errs) || len(errs) < 2 {
+		t.Fatalf("err = %v, want several syntax errors", err)
+	}
+	for i := 1; i < len(errs); i++ {
+		p, q := errs[i-1].Pos, errs[i].Pos
+		if q.Line < p.Line || (q.Line == p.Line && q.Column < p.Column) {
+			t.Errorf("errors not sorted: %v", errs)
+		}
+	}
+}
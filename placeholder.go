@@ -0,0 +1,200 @@
+package vdfloc
+
+// Placeholders consistency between the english source and the translation
+//
+// Recognised placeholders:
+//	%s, %d, %i, %f, %.1f ...  printf style, replaced in order
+//	%s1, %s2, %d1 ...         numbered: can be moved around in the translation
+//	{s:name}, {d:count} ...   Panorama variables: {<type>:<name>}, can be moved around
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Placeholder is a variable found in a value.
+type Placeholder struct {
+	Text     string // As written e.g. %s1 or {s:name}
+	Family   string // Type of placeholder e.g. %s or {s:
+	Numbered bool   // Position independent: numbered printf style or Panorama variable
+	Offset   int    // Byte offset in the value
+}
+
+var rePlaceholder = regexp.MustCompile(`%%|%[-+#0]*\d*(?:\.\d+)?([sdiufxXcgeE])(\d*)|\{([a-zA-Z]):[^{}\s]+\}`)
+
+// Placeholders()
+//
+// Returns the placeholders of a value in order of appearance.
+// %% (percent sign) is not a placeholder.
+//
+func Placeholders(value string) (list []Placeholder) {
+	for _, m := range rePlaceholder.FindAllStringSubmatchIndex(value, -1) {
+		text := value[m[0]:m[1]]
+		p := Placeholder{Text: text, Offset: m[0]}
+		switch {
+		case text == "%%":
+			continue
+		case m[2] >= 0: // printf style
+			p.Family = "%" + value[m[2]:m[3]]
+			p.Numbered = m[5] > m[4]
+		default: // Panorama
+			p.Family = "{" + value[m[6]:m[7]] + ":"
+			p.Numbered = true
+		}
+		list = append(list, p)
+	}
+	return list
+}
+
+// CheckPlaceholders()
+//
+// Check that the placeholders of a token value match the ones of its english source value:
+//	- missing or extra placeholders (error)
+//	- renamed placeholders e.g. {s:nmae} instead of {s:name} (error)
+//	- printf style placeholders not numbered in a different order (error)
+//	- numbered placeholders in a different order (info, this is allowed)
+// err != nil only in case of processing failure.
+//
+func (v *VDFFile) CheckPlaceholders(t Token, source string) (diags Diagnostics, err error) {
+
+	src, trn := Placeholders(source), Placeholders(t.Value)
+
+	// Match the placeholders present in both values
+	matched := make([]bool, len(trn))
+	var missing []Placeholder
+	for _, s := range src {
+		found := false
+		for i, p := range trn {
+			if !matched[i] && p.Text == s.Text {
+				matched[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, s)
+		}
+	}
+	var extra []Placeholder
+	for i, p := range trn {
+		if !matched[i] {
+			extra = append(extra, p)
+		}
+	}
+
+	// A missing and an extra placeholder of the same family: renamed
+	for _, m := range missing {
+		renamed := false
+		for i, e := range extra {
+			if e.Family == m.Family {
+				msg := fmt.Sprintf("Placeholder %s should be %s as in the source", e.Text, m.Text)
+				diags = append(diags, v.placeholderDiag(t, e, SeverityError, msg, fmt.Sprintf("Replace %s with %s.", e.Text, m.Text)))
+				extra = append(extra[:i], extra[i+1:]...)
+				renamed = true
+				break
+			}
+		}
+		if !renamed {
+			msg := fmt.Sprintf("Placeholder %s of the source is missing", m.Text)
+			diags = append(diags, newDiagnostic(RulePlaceholder, SeverityError, t, msg, ""))
+		}
+	}
+	for _, e := range extra {
+		msg := fmt.Sprintf("Placeholder %s is not in the source", e.Text)
+		diags = append(diags, v.placeholderDiag(t, e, SeverityError, msg, ""))
+	}
+	if len(diags) > 0 {
+		return diags, nil // Order is meaningless if the placeholders differ
+	}
+
+	// Same placeholders: check their order
+	for _, numbered := range []bool{false, true} {
+		s, p := filterPlaceholders(src, numbered), filterPlaceholders(trn, numbered)
+		for i := range s {
+			if s[i].Text == p[i].Text {
+				continue
+			}
+			if numbered {
+				msg := fmt.Sprintf("Placeholder %s moved compared to the source", p[i].Text)
+				diags = append(diags, v.placeholderDiag(t, p[i], SeverityInfo, msg, ""))
+			} else {
+				msg := fmt.Sprintf("Placeholder %s found where the source has %s: unnumbered placeholders can't be reordered", p[i].Text, s[i].Text)
+				diags = append(diags, v.placeholderDiag(t, p[i], SeverityError, msg, "Keep the order of the source or use numbered placeholders e.g. %s1."))
+			}
+			break
+		}
+	}
+	return diags, nil
+}
+
+// CheckPlaceholdersWithSource()
+//
+// Check the placeholders of all the tokens (see CheckPlaceholders()).
+// The source value of a token is the one of its [english] token if any, otherwise
+// the one of the same token in the english file en (may be nil).
+// Tokens without source are skipped.
+//
+func (v *VDFFile) CheckPlaceholdersWithSource(en *VDFFile) (diags Diagnostics, err error) {
+	v.log(fmt.Sprintf("CheckPlaceholdersWithSource()"))
+
+	return v.checkWithSource(en, v.CheckPlaceholders)
+}
+
+// checkWithSource()
+//
+// Run a check on all the tokens having a source value (see CheckPlaceholdersWithSource()).
+//
+func (v *VDFFile) checkWithSource(en *VDFFile, check func(Token, string) (Diagnostics, error)) (diags Diagnostics, err error) {
+	doc, err := v.tree()
+	if err != nil {
+		return diags, err
+	}
+
+	sources := make(map[string]string) // key + cond -> source value
+	if en != nil {
+		enDoc, err := en.tree()
+		if err != nil {
+			return diags, err
+		}
+		for _, n := range tokenPairs(enDoc) {
+			sources[n.Key+n.Cond] = n.Value
+		}
+	}
+	for _, n := range doc.Pairs() {
+		if isSourceKey(n.Key) {
+			sources[strings.TrimPrefix(n.Key, "[english]")+n.Cond] = n.Value
+		}
+	}
+
+	for _, n := range tokenPairs(doc) {
+		source, ok := sources[n.Key+n.Cond]
+		if !ok {
+			if source, ok = sources[n.Key]; !ok { // Unconditional variant
+				continue
+			}
+		}
+		d, err := check(tokenFromNode(n), source)
+		if err != nil {
+			return diags, err
+		}
+		diags = append(diags, d...)
+	}
+	return diags, nil
+}
+
+// placeholderDiag returns a diagnostic located on a placeholder of a token value
+func (v *VDFFile) placeholderDiag(t Token, p Placeholder, sev Severity, msg string, fix string) Diagnostic {
+	d := newDiagnostic(RulePlaceholder, sev, t, msg, fix)
+	d.Span = t.valueSpan(p.Offset, p.Offset+len(p.Text))
+	return d
+}
+
+// filterPlaceholders returns the numbered or unnumbered placeholders of a list
+func filterPlaceholders(list []Placeholder, numbered bool) (res []Placeholder) {
+	for _, p := range list {
+		if p.Numbered == numbered {
+			res = append(res, p)
+		}
+	}
+	return res
+}
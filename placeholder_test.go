@@ -0,0 +1,55 @@
+package vdfloc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"Hello %s", []string{"%s"}},
+		{"100%% of %d", []string{"%d"}},
+		{"%s2 then %s1", []string{"%s2", "%s1"}},
+		{"%s10 and %s2", []string{"%s10", "%s2"}},
+		{"%.1f {s:name} {d:count}", []string{"%.1f", "{s:name}", "{d:count}"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, p := range Placeholders(tt.value) {
+			got = append(got, p.Text)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("Placeholders(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPlaceholdersNumberedAboveNine(t *testing.T) {
+	v := &VDFFile{}
+	var args []string
+	for i := 1; i <= 11; i++ {
+		args = append(args, fmt.Sprintf("%%s%d", i))
+	}
+	source := strings.Join(args, " ")
+
+	// Reordered: allowed for numbered placeholders
+	args[9], args[10] = args[10], args[9]
+	trn := strings.Join(args, " ")
+	diags, err := v.CheckPlaceholders(Token{Key: "k", Value: trn}, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 1 || diags[0].Severity != SeverityInfo {
+		t.Errorf("reordered %%s10/%%s11: got %v, want a single info", diags)
+	}
+
+	// %s10 replaced with %s1 followed by 0: a mismatch
+	diags, _ = v.CheckPlaceholders(Token{Key: "k", Value: strings.Replace(source, "%s10", "%s1 0", 1)}, source)
+	if len(diags) == 0 || diags[0].Severity != SeverityError {
+		t.Errorf("missing %%s10: got %v, want an error", diags)
+	}
+}
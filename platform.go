@@ -0,0 +1,125 @@
+package vdfloc
+
+// Platform resolved tokens
+//
+// A platform is the set of conditional symbols the game defines when running on it
+// e.g. a Steam Deck build defines $LINUX, $POSIX and $DECK.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Platform is a target with the conditional symbols it defines.
+type Platform struct {
+	Name    string   // E.g. Windows
+	Symbols []string // E.g. WIN32 (with or without $)
+}
+
+// DefaultPlatforms()
+//
+// Returns the platforms Steam games usually ship to: Windows, macOS, Linux and Steam Deck.
+//
+func DefaultPlatforms() []Platform {
+	return []Platform{
+		{Name: "Windows", Symbols: []string{"WIN32"}},
+		{Name: "macOS", Symbols: []string{"OSX", "POSIX"}},
+		{Name: "Linux", Symbols: []string{"LINUX", "POSIX"}},
+		{Name: "Steam Deck", Symbols: []string{"LINUX", "POSIX", "DECK"}},
+	}
+}
+
+// GetTokenInMapFor()
+//
+// Return a map of the token/content active on a platform defining the symbols
+// passed as parameters (e.g. $DECK, $WIN32, $POSIX). See Resolve().
+//
+func (v *VDFFile) GetTokenInMapFor(platforms ...string) (s map[string]string, err error) {
+	v.log(fmt.Sprintf("GetTokenInMapFor(%s)", strings.Join(platforms, ", ")))
+
+	return v.Resolve(platforms...)
+}
+
+// UndefinedKeysFor()
+//
+// Returns the keys, in file order, that are not defined on a platform defining the
+// symbols passed as parameters because all their variants are conditional and none holds.
+// Invalid conditional statements never hold: err lists them (type CondErrors)
+// while keys is still returned.
+//
+func (v *VDFFile) UndefinedKeysFor(platforms ...string) (keys []string, err error) {
+	v.log(fmt.Sprintf("UndefinedKeysFor(%s)", strings.Join(platforms, ", ")))
+
+	doc, err := v.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, errs := undefinedFor(doc, platformSet(platforms))
+	for _, n := range nodes {
+		keys = append(keys, n.Key)
+	}
+	if len(errs) > 0 {
+		return keys, errs
+	}
+	return keys, nil
+}
+
+// CheckPlatformCoverage()
+//
+// Report the keys not defined on some of the platforms (see UndefinedKeysFor()),
+// DefaultPlatforms() if none is passed. Invalid conditional statements are left
+// to CheckConditionalStatement().
+// err != nil only in case of processing failure.
+//
+func (v *VDFFile) CheckPlatformCoverage(platforms ...Platform) (diags Diagnostics, err error) {
+	v.log(fmt.Sprintf("CheckPlatformCoverage()"))
+
+	doc, err := v.tree()
+	if err != nil {
+		return diags, err
+	}
+	if len(platforms) == 0 {
+		platforms = DefaultPlatforms()
+	}
+
+	for _, p := range platforms {
+		nodes, _ := undefinedFor(doc, platformSet(p.Symbols))
+		for _, n := range nodes {
+			msg := fmt.Sprintf("Token %s is not defined on %s: all its variants are conditional", n.Key, p.Name)
+			diags = append(diags, newDiagnostic(RuleUndefinedOn, SeverityWarning, tokenFromNode(n), msg, "Add a variant for this platform or an unconditional one."))
+		}
+	}
+	diags.Sort()
+	return diags, nil
+}
+
+// undefinedFor()
+//
+// Returns the first variant of the tokens without any variant active on a platform.
+// Only the tokens section is read (see tokenPairs()).
+//
+func undefinedFor(doc *Node, defined map[string]bool) (nodes []*Node, errs CondErrors) {
+	active := make(map[string]bool)
+	var keys []*Node
+	for _, n := range tokenPairs(doc) {
+		if _, seen := active[n.Key]; !seen {
+			keys = append(keys, n)
+			active[n.Key] = false
+		}
+		ok, err := activeInTree(n, defined)
+		if err != nil {
+			errs = append(errs, err.(*CondError))
+		}
+		if ok {
+			active[n.Key] = true
+		}
+	}
+
+	for _, n := range keys {
+		if !active[n.Key] {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, errs
+}
@@ -0,0 +1,88 @@
+package vdfloc
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const platformFile = `"lang"
+{
+	"Language"	"french"	[$X360]
+	"Tokens"
+	{
+		"[english]all"	"All"	[$X360]
+		"all"	"Tout"
+		"win"	"Windows"	[$WIN32]
+		"win"	"Autre"	[!$WIN32]
+		"x360"	"Xbox"	[$X360]
+		"notx"	"Pas Xbox"	[!$X360]
+		"comp"	"Windows ou Xbox"	[$WIN32 || $X360]
+		"both"	"Windows sans Xbox"	[$WIN32 && !$X360]
+		"bad"	"B"	[$WIN32 &&]
+	}
+	"Other"
+	{
+		"o"	"O"	[$X360]
+	}
+}
+`
+
+func TestPlatformResolution(t *testing.T) {
+	tests := []struct {
+		platforms []string
+		tokens    string // Resolved tokens sorted by key
+		undefined string // Keys in file order
+	}{
+		{[]string{"$WIN32"}, "all=Tout both=Windows sans Xbox comp=Windows ou Xbox notx=Pas Xbox win=Windows", "x360 bad"},
+		{[]string{"x360"}, "all=Tout comp=Windows ou Xbox win=Autre x360=Xbox", "notx both bad"},
+		{[]string{"OSX", "POSIX"}, "all=Tout notx=Pas Xbox win=Autre", "x360 comp both bad"},
+		{[]string{"WIN32", "X360"}, "all=Tout comp=Windows ou Xbox win=Windows x360=Xbox", "notx both bad"},
+		{nil, "all=Tout notx=Pas Xbox win=Autre", "x360 comp both bad"},
+	}
+	v, _ := NewFromBytes([]byte(platformFile), "x_french.txt")
+	for _, tt := range tests {
+		name := strings.Join(tt.platforms, " ")
+
+		m, err := v.GetTokenInMapFor(tt.platforms...)
+		var errs CondErrors
+		if !errors.As(err, &errs) || len(errs) != 1 {
+			t.Errorf("%s: GetTokenInMapFor() err = %v, want the invalid statement of bad", name, err)
+		}
+		var tokens []string
+		for k, val := range m {
+			tokens = append(tokens, k+"="+val)
+		}
+		sort.Strings(tokens)
+		if got := strings.Join(tokens, " "); got != tt.tokens {
+			t.Errorf("%s: GetTokenInMapFor() = %s\nwant %s", name, got, tt.tokens)
+		}
+
+		keys, err := v.UndefinedKeysFor(tt.platforms...)
+		if !errors.As(err, &errs) || len(errs) != 1 {
+			t.Errorf("%s: UndefinedKeysFor() err = %v, want the invalid statement of bad", name, err)
+		}
+		if got := strings.Join(keys, " "); got != tt.undefined {
+			t.Errorf("%s: UndefinedKeysFor() = %s, want %s", name, got, tt.undefined)
+		}
+	}
+}
+
+func TestPlatformCoverage(t *testing.T) {
+	v, _ := NewFromBytes([]byte(platformFile), "x_french.txt")
+	diags, err := v.CheckPlatformCoverage(Platform{Name: "Xbox", Symbols: []string{"X360"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, d := range diags {
+		if d.Rule != RuleUndefinedOn || d.Severity != SeverityWarning || !strings.Contains(d.Message, "Xbox") {
+			t.Errorf("diagnostic %v", d)
+		}
+		keys = append(keys, d.Key)
+	}
+	if got := strings.Join(keys, " "); got != "notx both bad" {
+		t.Errorf("keys undefined on Xbox: %s, want notx both bad", got)
+	}
+}
@@ -3,6 +3,7 @@ package vdfloc
 // Publicly available high level functions
 
 import (
+	_ "embed"
 	"fmt"
 	"github.com/fabdem/go-vdfloc/config"
 	"regexp"
@@ -14,20 +15,30 @@ import (
 // 	check	interface{}
 // 	}
 
-var m_pluralGender map[string]interface{}
+// Signature of the plural/gender check functions
+type checkPlrGdrFct func(conf *config.Config, k string, v string, lang string) (res string, err error)
+
+var m_pluralGender map[string]checkPlrGdrFct
 
 // var suffixesPluralGender []string
 var pluralTag string
 var genderTags []string
 var allTags []string
-var conf *config.Config
 
-const defaultJson = "pluralgender.json" // located along with the exe or bin
+const defaultJson = "pluralgender.json" // embedded in the package
+
+//go:embed pluralgender.json
+var defaultJsonContent []byte
+
+var embeddedConf *config.Config // Default plural/gender definitions
+
+// Plural/gender tag of a token key (:p, :n, :g, :gp, etc.) followed or not by {value_name}
+var rePlrGdrKey = regexp.MustCompile(`(:[png]{1,2})(?:\{[a-zA-Z_\d:]+\})?$`)
 
 func init() {
 
 	// Defines each token suffixe and its associated check function
-	m_pluralGender = map[string]interface{}{
+	m_pluralGender = map[string]checkPlrGdrFct{
 		":p":  checkPlural,               // plural
 		":n":  checkGenderSender,         // gender sender
 		":g":  checkGenderReceiver,       // gender receiver
@@ -49,30 +60,74 @@ func init() {
 
 	allTags = append(genderTags, pluralTag)
 
-	// Try to load the default config file
-	conf, _ = config.New(defaultJson)
+	// Load the default config embedded in the package
+	var err error
+	if embeddedConf, err = config.NewFromBytes(defaultJsonContent, defaultJson); err != nil {
+		panic(err) // the embedded file is part of the package: can only fail at dev time
+	}
+	defaults.conf = embeddedConf
 }
 
 // LoadJsonConf()
 //
-// Load a json config file.
+// Load a json config file replacing the plural/gender definitions used by default
+// by the instances created from this point (see Options.PluralGenderConfig to set
+// them per instance). The instances already created keep their definitions
+// (see SetPluralGenderConfig() to change them).
 // 	Input:
-//		- path and name or nil if default
+//		- path and name or empty to restore the definitions embedded in the package
 // 	Output:
-//		- err != nil if error
-//		- update global var conf
+//		- err != nil if error (the default config is then left unchanged)
 //
 func LoadJsonConf(f string) (err error) {
 
-	conf, err = config.New(f)
+	c := embeddedConf
+	if len(f) > 0 {
+		if c, err = config.New(f); err != nil {
+			return err
+		}
+	}
+
+	defaults.Lock()
+	defaults.conf = c
+	defaults.Unlock()
 
-	return err
+	return nil
+}
+
+// OverlayJsonConf()
+//
+// Load a json config file on top of the plural/gender definitions used by default:
+// the languages it defines replace or complete the current ones.
+// 	Input:
+//		- path and name
+// 	Output:
+//		- err != nil if error (the default config is then left unchanged)
+//
+func OverlayJsonConf(f string) (err error) {
+
+	c, err := config.New(f)
+	if err != nil {
+		return err
+	}
+
+	defaults.Lock()
+	defaults.conf = defaults.conf.Overlay(c)
+	defaults.Unlock()
+
+	return nil
+}
+
+// DefaultPluralGenderConfig returns the plural/gender definitions embedded in the package
+func DefaultPluralGenderConfig() *config.Config {
+	return embeddedConf
 }
 
 // checkPlural()
 //
 // Check plural syntax in a token value.
 // 	Input:
+//		- plural/gender definitions
 //		- token name
 //		- token value
 //		- Language name
@@ -80,7 +135,7 @@ func LoadJsonConf(f string) (err error) {
 //		- issue == nil if no syntax issue
 //		- err
 //
-func checkPlural(k string, v string, lang string) (res string, err error) {
+func checkPlural(conf *config.Config, k string, v string, lang string) (res string, err error) {
 	n, err := conf.GetPlural(lang)
 	if err != nil {
 		return res, err
@@ -100,6 +155,7 @@ func checkPlural(k string, v string, lang string) (res string, err error) {
 //
 // Check gender syntax in a sender token value. Needs either 1 of tag list for that language.
 // 	Input:
+//		- plural/gender definitions
 //		- token name
 //		- token value
 //		- Language name
@@ -107,7 +163,7 @@ func checkPlural(k string, v string, lang string) (res string, err error) {
 //		- issue == nil if no syntax issue
 //		- err
 //
-func checkGenderSender(k string, v string, lang string) (res string, err error) {
+func checkGenderSender(conf *config.Config, k string, v string, lang string) (res string, err error) {
 	l, err := conf.GetGenders(lang)
 	if err != nil {
 		return res, err
@@ -149,6 +205,7 @@ func checkGenderSender(k string, v string, lang string) (res string, err error)
 //
 // Check gender syntax in a receiver token value. Needs 1 of each tag for that language.
 // 	Input:
+//		- plural/gender definitions
 //		- token name
 //		- token value
 //		- Language name
@@ -156,7 +213,7 @@ func checkGenderSender(k string, v string, lang string) (res string, err error)
 //		- issue == nil if no syntax issue
 //		- err
 //
-func checkGenderReceiver(k string, v string, lang string) (res string, err error) {
+func checkGenderReceiver(conf *config.Config, k string, v string, lang string) (res string, err error) {
 	l, err := conf.GetGenders(lang)
 	if err != nil {
 		return res, err
@@ -208,6 +265,7 @@ func checkGenderReceiver(k string, v string, lang string) (res string, err error
 // tags valid for the language as they are plurals.
 // If there are no genders but plurals (e.g. schinese) plurals are separated with the plural tag.
 // 	Input:
+//		- plural/gender definitions
 //		- token name
 //		- token value
 //		- Language name
@@ -217,7 +275,7 @@ func checkGenderReceiver(k string, v string, lang string) (res string, err error
 //
 //	E.g. "Valve_TestPluralGenders_Noun1:np"    "#|m|#Trésor#|m|#Trésors"
 //
-func checkGenderSenderPlural(k string, v string, lang string) (res string, err error) {
+func checkGenderSenderPlural(conf *config.Config, k string, v string, lang string) (res string, err error) {
 	l, err := conf.GetGenders(lang) // Get the list of gender tags
 	if err != nil {
 		return res, err
@@ -267,6 +325,7 @@ func checkGenderSenderPlural(k string, v string, lang string) (res string, err e
 // Each gender list must be repeated as many time as there are plurals for the language.
 // If there are no genders but plurals (e.g. schinese) plurals are separated with the plural tag.
 // 	Input:
+//		- plural/gender definitions
 //		- token name
 //		- token value
 //		- Language name
@@ -276,7 +335,7 @@ func checkGenderSenderPlural(k string, v string, lang string) (res string, err e
 //
 // E.g. "Valve_TestPluralGenders_Adjective1:gp" "#|m|#peu Commun#|f|#peu Commune#|m|#peu Communs#|f|#peu Communes"
 //
-func checkGenderReceiverPlural(k string, v string, lang string) (res string, err error) {
+func checkGenderReceiverPlural(conf *config.Config, k string, v string, lang string) (res string, err error) {
 	lgGenderTags, err := conf.GetGenders(lang) // Get the list of gender tags
 	if err != nil {
 		return res, err // Processing error
@@ -316,7 +375,7 @@ func checkGenderReceiverPlural(k string, v string, lang string) (res string, err
 			if ok := strings.Contains(list, gender); (ct != nbPluralExpected || !ok) && (ct != 0 || ok) {
 				// bad syntax cases: wrong tag present or correct tag but wrong number of instances
 				if len(list) > 0 {
-					res = fmt.Sprintf("Error with gender/plural form: %s - found %d plural forms while expecting %d of each gender group: %s", ct, gender, nbPluralExpected, list)
+					res = fmt.Sprintf("Error with gender/plural form: %s - found %d plural forms while expecting %d of each gender group: %s", gender, ct, nbPluralExpected, list)
 				} else {
 					res = fmt.Sprintf("Error with gender/plural form: %s - no gender expected", gender) // No gender expected but found gender tags...
 				}
@@ -381,52 +440,57 @@ func (v *VDFFile) FilterPlrGdr(in []string) (out []string) {
 	return out
 }
 
-// checkNonPlrlGdr()
+// CheckNonPlrlGdr()
 //
 // Check that the value of a non plural/gender key doesn't contain
 // plural separators or gender tags.
 // 	Input:
-//		- token value
+//		- token
 // 	Output:
-//		- issue == nil if no syntax issue
+//		- diags: empty if no syntax issue
 //		- err != nil if processing error
 //
-func (v *VDFFile) CheckNonPlrlGdr(key string, val string) (issue string, err error) {
+func (v *VDFFile) CheckNonPlrlGdr(t Token) (diags Diagnostics, err error) {
 	// v.log(fmt.Sprintf("CheckNonPlrlGdr(%s, %s)", key, val)) remove log out of concerns about performance impact
 
 	for _, tag := range allTags {
-		if strings.Index(val, tag) != -1 {
-			issue = fmt.Sprintf("Error - found plural separators and/or gender tags (%s) in a non gendered/plural token: %s - %s", tag, key, val)
+		if strings.Index(t.Value, tag) != -1 {
+			msg := fmt.Sprintf("Found plural separators and/or gender tags (%s) in a non gendered/plural token: %s - %s", tag, t.Key, t.Value)
+			diags = append(diags, newDiagnostic(RuleNonPluralGdr, SeverityError, t, msg, "Remove the tags or add the plural/gender suffix to the key."))
 			break
 		}
 	}
-	return issue, err
+	return diags, err
 }
 
 // CheckPlrlGendrTokenVal()
 //
 // Check plural and gender syntax of a token value.
-// If it's not a plural or gender token just ignore (return nil string)
-// unless there are plural separators or gender tags in the value.
+// If it's not a plural or gender token just ignore (return no diagnostic).
 // 	Input:
-//		- token name
-//		- token value
+//		- token
 //		- Language name
 // 	Output:
-//		- issue == nil if no syntax issue or not a gender/plural variant
-//		- err
+//		- diags: empty if no syntax issue or not a gender/plural variant
+//		- err != nil if processing error (e.g. language not in config, config.ErrNoConfig
+//		  if the instance has no plural/gender definitions)
 //
-func (v *VDFFile) CheckPlrlGendrTokenVal(token string, val string, language string) (issue string, err error) {
-	v.log(fmt.Sprintf("CheckPlrlGendrTokenVal(%s, %s, %s)", token, val, language))
+func (v *VDFFile) CheckPlrlGendrTokenVal(t Token, language string) (diags Diagnostics, err error) {
+	v.log(fmt.Sprintf("CheckPlrlGendrTokenVal(%s, %s, %s)", t.Key, t.Value, language))
 
 	// Capture tag (:p, :n, :g, :gp, etc.) and call the right function to check syntax
-	if capturedTag := regexp.MustCompile(`(:[png]{1,2})(?:\{[a-zA-Z_\d:]+\})?$`).FindStringSubmatch(token); len(capturedTag) > 1 {
+	if capturedTag := rePlrGdrKey.FindStringSubmatch(t.Key); len(capturedTag) > 1 {
 
 		if f, ok := m_pluralGender[capturedTag[1]]; ok {
-			issue, err = f.(func(string, string, string) (string, error))(token, val, language) // Check syntax
-			// bOK,bArrayRes := record.fctOpen.(func (string) (bool,[]byte))(openingTag)
+			issue, err := f(v.pluralGenderConfig(), t.Key, t.Value, language) // Check syntax
+			if err != nil {
+				return diags, err
+			}
+			if len(issue) > 0 {
+				diags = append(diags, newDiagnostic(RulePluralGender, SeverityError, t, issue, ""))
+			}
 		}
 	}
-	
-	return issue, err
+
+	return diags, nil
 }
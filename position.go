@@ -0,0 +1,116 @@
+package vdfloc
+
+// Source positions
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// Position locates a character in a source file.
+type Position struct {
+	File   string `json:"file,omitempty"` // File name, may be empty
+	Line   int    `json:"line"`           // Line number, starting at 1
+	Column int    `json:"column"`         // Column number in characters, starting at 1
+	Offset int    `json:"offset"`         // Byte offset in the utf8 decoded source, starting at 0
+}
+
+// String()
+//
+// Returns the position in the usual file:line:column form.
+// The file name is omitted if empty, the column if unknown.
+//
+func (p Position) String() string {
+	s := p.File
+	if p.Line > 0 {
+		if len(s) > 0 {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d", p.Line)
+		if p.Column > 0 {
+			s += fmt.Sprintf(":%d", p.Column)
+		}
+	}
+	if len(s) == 0 {
+		s = "-"
+	}
+	return s
+}
+
+// IsValid returns true if the line number is known.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// Span is the range of source text covered by an element: from Start to End (excluded).
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+func (s Span) String() string {
+	return s.Start.String()
+}
+
+// lineTable converts byte offsets to line/column positions.
+type lineTable struct {
+	file  string
+	buf   []byte
+	lines []int // offset of the first byte of each line
+}
+
+func newLineTable(file string, buf []byte) *lineTable {
+	t := &lineTable{file: file, buf: buf, lines: []int{0}}
+	for i, c := range buf {
+		if c == '\n' {
+			t.lines = append(t.lines, i+1)
+		}
+	}
+	return t
+}
+
+// position()
+//
+// Returns the position of a byte offset.
+//
+func (t *lineTable) position(offset int) Position {
+	if offset > len(t.buf) {
+		offset = len(t.buf)
+	}
+	// index of the last line starting at or before offset
+	l := sort.Search(len(t.lines), func(i int) bool { return t.lines[i] > offset }) - 1
+	return Position{
+		File:   t.file,
+		Line:   l + 1,
+		Column: utf8.RuneCount(t.buf[t.lines[l]:offset]) + 1,
+		Offset: offset,
+	}
+}
+
+// span returns the span between two byte offsets
+func (t *lineTable) span(start, end int) Span {
+	return Span{Start: t.position(start), End: t.position(end)}
+}
+
+// textSpan returns the span of a single line text starting at pos
+func textSpan(pos Position, text string) Span {
+	end := pos
+	end.Offset += len(text)
+	end.Column += utf8.RuneCountInString(text)
+	return Span{Start: pos, End: end}
+}
+
+// advance returns the position following text starting at pos
+func advance(pos Position, text string) Position {
+	for _, r := range text {
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+		pos.Offset += utf8.RuneLen(r)
+	}
+	return pos
+}
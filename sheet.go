@@ -0,0 +1,230 @@
+package vdfloc
+
+// CSV/TSV spreadsheets with all the languages side by side
+//
+// One row per token variant of the english file, one column per language:
+//	key,condition,english,french,german
+//	a_key,,Hello,Bonjour,Hallo
+//	a_key,[$WIN32],Hello Windows,Bonjour Windows,Hallo Windows
+// Values are written with their escape sequences decoded: line breaks, tabs and double
+// quotes are real characters, quoted as needed (RFC 4180). Files are in UTF-8 with a BOM
+// so that Excel detects the encoding. As in spreadsheets, line breaks are read as \n:
+// a value of a loc file only differing by its CR LF line breaks is left unchanged on merge.
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	SheetCSV = ','  // Field separator of CSV sheets
+	SheetTSV = '\t' // Field separator of TSV sheets
+)
+
+// Sheet is the content of a spreadsheet (see ImportSheet()).
+type Sheet struct {
+	Languages []string // Steam names of the language columns in sheet order e.g. english, french
+	Rows      []SheetRow
+}
+
+// SheetRow is a token variant with its value in each language.
+type SheetRow struct {
+	Key    string
+	Cond   string            // Conditional statement e.g. [$WIN32]
+	Values map[string]string // Steam language name -> value (escape sequences decoded), empty if none
+	Line   int               // Line of the row in the sheet
+}
+
+// ExportSheet()
+//
+// Write the tokens of the english file with their translation in the loc files
+// in a CSV (comma SheetCSV) or TSV (comma SheetTSV) sheet (see above).
+// Each loc file must belong to the english file (see GetEnFileName()); its language
+// is the one of its file name.
+// err != nil if a loc file doesn't belong to the english file or has no Steam language
+// in its name, if two loc files have the same language or in case of processing failure.
+//
+func ExportSheet(en *VDFFile, locs []*VDFFile, w io.Writer, comma rune) (err error) {
+	en.log(fmt.Sprintf("ExportSheet(%s, %d loc files)", en.fileName, len(locs)))
+
+	header := []string{"key", "condition", "english"}
+	var columns [][]translationUnit
+	seen := map[string]bool{"english": true}
+	for _, loc := range locs {
+		enName, err := loc.GetEnFileName()
+		if err != nil {
+			return fmt.Errorf("ExportSheet() - %v", err)
+		}
+		if !strings.EqualFold(enName, en.fileName) {
+			return fmt.Errorf("ExportSheet() - %s doesn't belong to %s", loc.fileName, en.fileName)
+		}
+		lang, err := LanguageFromFileName(loc.fileName)
+		if err != nil {
+			return fmt.Errorf("ExportSheet() - %v", err)
+		}
+		if seen[lang.Name] {
+			return fmt.Errorf("ExportSheet() - Several files for %s", lang.Name)
+		}
+		seen[lang.Name] = true
+
+		units, err := translationUnits(en, loc)
+		if err != nil {
+			return err
+		}
+		header = append(header, lang.Name)
+		columns = append(columns, units)
+	}
+	units, err := translationUnits(en, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.WriteString(w, "\ufeff"); err != nil { // BOM
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	cw.Write(header)
+	for i, u := range units {
+		row := []string{u.Key, u.Cond, u.Source}
+		for _, c := range columns {
+			row = append(row, c[i].Target) // Same english units in the same order
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportSheet()
+//
+// Read a CSV (comma SheetCSV) or TSV (comma SheetTSV) sheet (see above).
+// Language columns can be named with a Steam name, a Web API code or a BCP-47 tag.
+// See MergeSheet() to update the loc files.
+// err != nil if the sheet is malformed, if the key or a language column is missing
+// or if a column is unknown.
+//
+func ImportSheet(r io.Reader, comma rune) (s *Sheet, err error) {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(3); err == nil && string(b) == "\ufeff" {
+		br.Discard(3)
+	}
+
+	cr := csv.NewReader(br)
+	cr.Comma = comma
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("ImportSheet() - Empty sheet")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ImportSheet() - %v", err)
+	}
+
+	s = &Sheet{}
+	keyCol, condCol := -1, -1
+	langCols := make(map[int]string)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		switch strings.ToLower(name) {
+		case "key":
+			keyCol = i
+		case "condition":
+			condCol = i
+		default:
+			lang, ok := LookupLanguage(name)
+			if !ok {
+				return nil, fmt.Errorf("ImportSheet() - line 1: unknown column %q", name)
+			}
+			for _, l := range s.Languages {
+				if l == lang.Name {
+					return nil, fmt.Errorf("ImportSheet() - line 1: several columns for %s", lang.Name)
+				}
+			}
+			langCols[i] = lang.Name
+			s.Languages = append(s.Languages, lang.Name)
+		}
+	}
+	if keyCol < 0 {
+		return nil, fmt.Errorf("ImportSheet() - line 1: column key missing")
+	}
+	if len(langCols) == 0 {
+		return nil, fmt.Errorf("ImportSheet() - line 1: no language column")
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ImportSheet() - %v", err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		row := SheetRow{Key: strings.TrimSpace(record[keyCol]), Values: make(map[string]string), Line: line}
+		if condCol >= 0 {
+			row.Cond = normalizeCond(record[condCol])
+		}
+		if len(row.Key) == 0 {
+			return nil, fmt.Errorf("ImportSheet() - line %d: empty key", line)
+		}
+		if len(row.Cond) > 0 {
+			if _, err := ParseCond(row.Cond); err != nil {
+				return nil, fmt.Errorf("ImportSheet() - line %d: %v", line, err)
+			}
+		}
+		for i, lang := range langCols {
+			row.Values[lang] = record[i]
+		}
+		s.Rows = append(s.Rows, row)
+	}
+	return s, nil
+}
+
+// MergeSheet()
+//
+// Set the values of the column of the language of the loc file (header, or else
+// file name). Empty cells are ignored. Tokens keep their place and new ones are
+// inserted following the order of the sheet. Save() then writes the file in its encoding.
+// Returns the number of token variants added or modified.
+// err != nil if the language of the file is unknown or has no column.
+//
+func (v *VDFFile) MergeSheet(s *Sheet) (merged int, err error) {
+	v.log(fmt.Sprintf("MergeSheet()"))
+
+	lang, ok := v.fileLanguage()
+	if !ok {
+		return 0, fmt.Errorf("MergeSheet() - Unknown language for %s", v.fileName)
+	}
+	found := false
+	for _, l := range s.Languages {
+		found = found || l == lang.Name
+	}
+	if !found {
+		return 0, fmt.Errorf("MergeSheet() - No column for %s", lang.Name)
+	}
+
+	doc, err := v.tree()
+	if err != nil {
+		return 0, err
+	}
+	current := make(map[string]string) // key + cond -> value with CR LF line breaks
+	for _, n := range tokenPairs(doc) {
+		if value, _ := Unescape(n.Value); strings.Contains(value, "\r\n") {
+			current[n.Key+normalizedCond(n.Cond)] = value
+		}
+	}
+
+	var units []translationUnit
+	for _, row := range s.Rows {
+		value := row.Values[lang.Name]
+		if c, ok := current[row.Key+normalizedCond(row.Cond)]; ok && strings.Replace(c, "\r\n", "\n", -1) == value {
+			value = c // Line breaks lost in the sheet
+		}
+		units = append(units, translationUnit{Key: row.Key, Cond: row.Cond, Source: row.Values["english"], Target: value, Translated: len(value) > 0})
+	}
+	return v.mergeTranslations(units)
+}
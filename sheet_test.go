@@ -0,0 +1,124 @@
+package vdfloc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const exchangeGerman = "\"lang\"\n{\n\t\"Language\"\t\"german\"\n\t\"Tokens\"\n\t{\n" +
+	"\t\t\"b\"\t\"Zeile 1\\nZeile 2\\tTab, \\\"Komma\\\"\"\n" +
+	"\t\t\"f\"\t\"Nicht\tübersetzt\"\n" +
+	"\t}\n}\n"
+
+func TestSheetRoundTrip(t *testing.T) {
+	for _, comma := range []rune{SheetCSV, SheetTSV} {
+		en, fr := exchangeFiles(t)
+		de, _ := NewFromBytes([]byte(exchangeGerman), "x_german.txt")
+
+		var buf bytes.Buffer
+		if err := ExportSheet(en, []*VDFFile{fr, de}, &buf, comma); err != nil {
+			t.Fatalf("%q: ExportSheet(): %v", comma, err)
+		}
+		header := strings.Join([]string{"\ufeffkey", "condition", "english", "french", "german\n"}, string(comma))
+		if !strings.HasPrefix(buf.String(), header) {
+			t.Errorf("%q: ExportSheet():\n%s", comma, buf.String())
+		}
+
+		s, err := ImportSheet(bytes.NewReader(buf.Bytes()), comma)
+		if err != nil {
+			t.Fatalf("%q: ImportSheet(): %v", comma, err)
+		}
+		if strings.Join(s.Languages, " ") != "english french german" || len(s.Rows) != 7 {
+			t.Errorf("%q: imported %v, %d rows", comma, s.Languages, len(s.Rows))
+		}
+		for _, r := range s.Rows {
+			if r.Key == "c" && (r.Values["english"] != "Real\ttab\non two lines" || r.Values["french"] != "Vraie\ttabulation\nsur deux lignes") { // Line breaks read as \n
+				t.Errorf("%q: c = %q", comma, r.Values)
+			}
+			if r.Key == "b" && r.Values["german"] != "Zeile 1\nZeile 2\tTab, \"Komma\"" {
+				t.Errorf("%q: b = %q", comma, r.Values)
+			}
+		}
+
+		want := decodedTokens(t, fr)
+		want["c"] = strings.Replace(want["c"], "\r\n", "\n", -1)
+		checkMergeWant(t, fr, want, func(loc *VDFFile) (int, error) { return loc.MergeSheet(s) })
+
+		// Each loc file takes its own column
+		emptyDe, _ := NewFromBytes([]byte(strings.Replace(emptyFrench, "french", "german", 1)), "x_german.txt")
+		if merged, err := emptyDe.MergeSheet(s); merged != 2 || err != nil {
+			t.Errorf("%q: MergeSheet(german) = %d, %v", comma, merged, err)
+		}
+		if got, want := decodedTokens(t, emptyDe), decodedTokens(t, de); !equalMaps(got, want) {
+			t.Errorf("%q: german tokens\n%q\nwant\n%q", comma, got, want)
+		}
+	}
+}
+
+func TestSheetEdited(t *testing.T) {
+	src := "key;condition;english;FR\r\n" +
+		"a;$WIN32;Hello;\"Bonjour\r\n\"\"vous\"\"\"\r\n" +
+		"new;;New;Nouveau\r\n" +
+		"untranslated;;Empty;\r\n"
+	s, err := ImportSheet(strings.NewReader(src), ';')
+	if err != nil {
+		t.Fatalf("ImportSheet(): %v", err)
+	}
+	if r := s.Rows[0]; r.Cond != "[$WIN32]" || r.Values["french"] != "Bonjour\n\"vous\"" || r.Line != 2 {
+		t.Errorf("row 1 = %+v", r)
+	}
+	if s.Rows[1].Line != 4 {
+		t.Errorf("row 2 on line %d, want 4", s.Rows[1].Line)
+	}
+
+	fr, _ := NewFromBytes([]byte(emptyFrench), "x_french.txt")
+	if merged, err := fr.MergeSheet(s); merged != 2 || err != nil {
+		t.Fatalf("MergeSheet() = %d, %v", merged, err)
+	}
+	var out bytes.Buffer
+	fr.Write(&out)
+	want := "\"lang\"\r\n{\r\n\t\"Language\"\t\"french\"\r\n\t\"Tokens\"\r\n\t{\r\n" +
+		"\t\t\"a\"\t\"Bonjour\\n\\\"vous\\\"\"\t[$WIN32]\r\n" +
+		"\t\t\"new\"\t\"Nouveau\"\r\n" +
+		"\t}\r\n}\r\n"
+	if out.String() != want {
+		t.Errorf("merged file:\n%q\nwant\n%q", out.String(), want)
+	}
+}
+
+func TestSheetErrors(t *testing.T) {
+	en, fr := exchangeFiles(t)
+	other, _ := NewFromBytes([]byte(emptyFrench), "y_french.txt")
+	noLang, _ := NewFromBytes([]byte(emptyFrench), "x_fr.txt")
+	for name, locs := range map[string][]*VDFFile{
+		"other english file": {other},
+		"same language":      {fr, fr},
+		"no language":        {noLang},
+	} {
+		if err := ExportSheet(en, locs, new(bytes.Buffer), SheetCSV); err == nil {
+			t.Errorf("ExportSheet(%s): no error", name)
+		}
+	}
+
+	for _, src := range []string{
+		"",
+		"key,klingon\n",
+		"key,french,fr\n",
+		"condition,french\n",
+		"key,condition\n",
+		"key,french\n,x\n",
+		"key,condition,french\na,[$WIN32,x\n",
+		"key,french\na,\"unterminated\n",
+		"key,french\na,b,c\n",
+	} {
+		if _, err := ImportSheet(strings.NewReader(src), SheetCSV); err == nil {
+			t.Errorf("ImportSheet(%q): no error", src)
+		}
+	}
+
+	s, _ := ImportSheet(strings.NewReader("key,german\na,A\n"), SheetCSV)
+	if _, err := fr.MergeSheet(s); err == nil {
+		t.Errorf("MergeSheet() without french column: no error")
+	}
+}
@@ -0,0 +1,73 @@
+package vdfloc
+
+// Token: a key/value pair of a loc file along with its location
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Token is a key/value pair as found in a loc file.
+// Key, value, conditional statement and comment are stored as written (escape sequences are not decoded).
+type Token struct {
+	Key     string // E.g. a_key
+	Value   string // E.g. a value\non two lines
+	Decoded string // Value with its escape sequences decoded (see Unescape())
+	Cond    string // E.g. [$WIN32]
+	Comment string // E.g. // A comment
+	Line    string // The entire token: "a_key"	"a value" [$WIN32]	// A comment
+	Span    Span   // Location in the source
+
+	node *Node
+}
+
+// Pos returns the position of the first character of the token.
+func (t Token) Pos() Position {
+	return t.Span.Start
+}
+
+// Origin returns the name of the file the token comes from (see GetMergedTokens()).
+func (t Token) Origin() string {
+	return t.Span.Start.File
+}
+
+// String returns the token location and key e.g. czech.txt:1432:5: a_key[$WIN32]
+func (t Token) String() string {
+	return fmt.Sprintf("%s: %s%s", t.Span.Start, t.Key, t.Cond)
+}
+
+// tokenFromNode()
+//
+// Build a token out of a pair node.
+//
+func tokenFromNode(n *Node) Token {
+	decoded, _ := Unescape(n.Value) // Invalid sequences are kept as is
+	return Token{
+		Key:     n.Key,
+		Value:   n.Value,
+		Decoded: decoded,
+		Cond:    n.Cond,
+		Comment: n.Comment,
+		Line:    n.lineText(),
+		Span:    n.Span,
+		node:    n,
+	}
+}
+
+// valueSpan()
+//
+// Returns the span of the bytes start to end of the value.
+// If the value wasn't read from the source as is, the span of the token is returned.
+//
+func (t Token) valueSpan(start, end int) Span {
+	n := t.node
+	if n == nil || n.raw == nil || n.raw.origValue != t.Value || n.raw.origKey != n.Key || start > end || end > len(t.Value) {
+		return t.Span
+	}
+	pos := advance(t.Span.Start, n.raw.key+n.raw.valueSep)
+	if strings.HasPrefix(n.raw.value, "\"") {
+		pos = advance(pos, "\"")
+	}
+	pos = advance(pos, t.Value[:start])
+	return Span{Start: pos, End: advance(pos, t.Value[start:end])}
+}
@@ -4,14 +4,12 @@ package vdfloc
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"io"
-	"bufio"
 )
 
 // GetTokenNames()
@@ -23,26 +21,35 @@ import (
 func (v *VDFFile) GetTokenNames() (s []string, err error) {
 	v.log(fmt.Sprintf("GetTokenNames()"))
 
-	buf, err := v.ReadSource()
+	doc, err := v.tree()
 	if err != nil {
 		return s, err
 	}
 
-	res, err := v.SkipHeader(buf)
-	if err != nil {
-		return s, err
+	for _, n := range tokenPairs(doc) { // Skips the header and the token names begining with [english]
+		s = append(s, n.Key)
 	}
 
-	tokens, err := v.ParseInSlice(res)
+	return s, err
+}
 
-	for _, tkn := range tokens {
-		// Skip token names begining with [english].
-		if !strings.HasPrefix(tkn[1], "[english]") {
-			s = append(s, tkn[1])
-		}
+// GetTokens()
+//
+// Return a slice with all the tokens and their position.
+// Excludes the ones prefixed with [english] unless SetKeepSourceTokens() was called.
+//
+func (v *VDFFile) GetTokens() (tokens []Token, err error) {
+	v.log(fmt.Sprintf("GetTokens()"))
+
+	doc, err := v.tree()
+	if err != nil {
+		return tokens, err
 	}
 
-	return s, err
+	for _, n := range tokenPairsKeep(doc, v.GetKeepSourceTokenFlag()) {
+		tokens = append(tokens, tokenFromNode(n))
+	}
+	return tokens, nil
 }
 
 // GetStringsWithConditionalStatement()
@@ -54,26 +61,15 @@ func (v *VDFFile) GetTokenNames() (s []string, err error) {
 func (v *VDFFile) GetStringsWithConditionalStatement() (s [][]string, err error) {
 	v.log(fmt.Sprintf("GetStringsWithConditionalStatement()"))
 
-	buf, err := v.ReadSource()
-	if err != nil {
-		return s, err
-	}
-
-	res, err := v.SkipHeader(buf)
-	if err != nil {
-		return s, err
-	}
-
-	tokens, err := v.ParseInSlice(res)
+	doc, err := v.tree()
 	if err != nil {
 		return s, err
 	}
-	for _, tkn := range tokens {
-		//fmt.Println("%s\n",strings.TrimLeft(tkn[0], "\t \r\n"))
-		// Skip token names begining with [english] and the ones with no cond statements.
-		if !strings.HasPrefix(tkn[1], "[english]") && len(tkn[3]) > 0 {
 
-			s = append(s, []string{strings.TrimLeft(tkn[0], "\t \r\n"), tkn[1], tkn[2], tkn[3], tkn[4]})
+	for _, n := range tokenPairs(doc) {
+		// Skip the ones with no cond statements.
+		if len(n.Cond) > 0 {
+			s = append(s, []string{n.lineText(), n.Key, n.Value, n.Cond, n.Comment})
 		}
 	}
 
@@ -87,19 +83,17 @@ func (v *VDFFile) GetStringsWithConditionalStatement() (s [][]string, err error)
 func (v *VDFFile) GetTokenInMap() (s map[string]string, err error) {
 	v.log(fmt.Sprintf("GetTokenInMap()"))
 
-	buf, err := v.ReadSource()
+	doc, err := v.tree()
 	if err != nil {
 		return s, err
 	}
 
-	res, err := v.SkipHeader(buf)
-	if err != nil {
-		return s, err
+	s = make(map[string]string)
+	for _, n := range tokenPairsKeep(doc, v.GetKeepSourceTokenFlag()) {
+		s[n.Key] = n.Value
 	}
 
-	tokens, err := v.ParseInMap(res)
-
-	return tokens, err
+	return s, nil
 }
 
 // GetEnFileName()
@@ -119,6 +113,9 @@ func (v *VDFFile) GetEnFileName() (enFileName string, err error) {
 // Returns the name of the english file (source) corresponding to the loc file name passed as a parameter.
 //  err != nil if loc file name is empty
 //  A loc file name is formed like this xxxx_<language>.yyy or <language>.yyy
+//  (see FileNameForLanguage() for other languages)
+//  If the name doesn't end with a Steam language, what follows the last underscore
+//  is replaced (xxxx_yyyy.txt -> xxxx_english.txt, xxxx.txt -> english.txt).
 //
 func GetEnFileName(locFileName string) (enFileName string, err error) {
 
@@ -126,8 +123,13 @@ func GetEnFileName(locFileName string) (enFileName string, err error) {
 		return "", fmt.Errorf("Paramer shoudn't be empty.")
 	}
 
+	if _, err = LanguageFromFileName(locFileName); err == nil {
+		english, _ := LookupLanguage("english")
+		return FileNameForLanguage(filepath.Base(locFileName), english), nil
+	}
+
 	extension := filepath.Ext(locFileName)
-	base := strings.TrimRight(filepath.Base(locFileName), extension)
+	base := strings.TrimSuffix(filepath.Base(locFileName), extension)
 
 	if lastUnderscore := strings.LastIndex(base, "_"); lastUnderscore == -1 {
 		return "english" + extension, nil
@@ -136,128 +138,151 @@ func GetEnFileName(locFileName string) (enFileName string, err error) {
 	}
 }
 
+// CheckSyntax()
+//
+// Parse a byte buffer and report its KeyValues syntax errors.
+// Isolated conditional statements are left to CheckIsolatedConditionalStatements().
+// err != nil only in case of processing failure.
+func (v *VDFFile) CheckSyntax(buf []byte) (diags Diagnostics, err error) {
+	v.log(fmt.Sprintf("CheckSyntax()"))
+
+	_, perr := ParseFile(v.fileName, buf)
+	errs, _ := perr.(SyntaxErrors)
+
+	for _, e := range errs {
+		if e.Kind != SyntaxIsolatedCond {
+			diags = append(diags, Diagnostic{Rule: RuleSyntax, Severity: SeverityError, Message: e.Msg, Span: textSpan(e.Pos, e.Text)})
+		}
+	}
+	return diags, nil
+}
+
 // CheckKeyValidity()
 //
 // Tries to detect missing or wrongly escaped double quotes.
 // Has better chances to work with non English files.
 // Not bulletproof since key value pairs detection is based on valid characters.
 //
-// Parse all keys statements from a slice of tokens (uses FuzzyParseInSlice())
-// and returns an error if they are invalid (longer than autorized maxKeyLen or empty
-// or containing tabs or other non english characters),
-// plus a list of the offending token keys if any.
+// Parse all keys statements from a slice of tokens (uses ParseTokens())
+// and returns a diagnostic for each invalid one (longer than autorized maxKeyLen or empty
+// or containing tabs or other non english characters).
+// err != nil only in case of processing failure.
 
-func (v *VDFFile) CheckKeyValidity(tokens [][]string) (list []string, err error) {
+func (v *VDFFile) CheckKeyValidity(tokens []Token) (diags Diagnostics, err error) {
 	v.log(fmt.Sprintf("CheckKeyValidity()"))
 
-	// Parse all keys
-	err_flag := false
-
 	var isKeyNameCharValid = regexp.MustCompile(`^[0-9a-zA-Z\[\]\$#_:&!\|.\-\+/ \^'\{\}]+$`).MatchString
 
+	const fix = "Look for a missing or wrongly escaped double quote on this line or the previous one."
+	maxKeyLen := v.ReadMaxKeyLen()
+
 	for _, tkn := range tokens {
-		// fmt.Printf("|1>%s|2>%s|3>%s|4>%s\n",tkn[1],tkn[2],tkn[3],tkn[4] )
-		if len(tkn[1]) > v.maxKeyLen || len(tkn[1]) <= 0 || !isKeyNameCharValid(tkn[1]) {
-			list = append(list, tkn[1])
-			err_flag = true
+		switch {
+		case len(tkn.Key) <= 0:
+			diags = append(diags, newDiagnostic(RuleKeyValidity, SeverityError, tkn, "Empty key", fix))
+		case len(tkn.Key) > maxKeyLen:
+			diags = append(diags, newDiagnostic(RuleKeyValidity, SeverityError, tkn, fmt.Sprintf("Key longer than %d characters: %q", maxKeyLen, tkn.Key), fix))
+		case !isKeyNameCharValid(tkn.Key):
+			diags = append(diags, newDiagnostic(RuleKeyValidity, SeverityError, tkn, fmt.Sprintf("Invalid character(s) in key %q", tkn.Key), fix))
 		}
 	}
 
-	if err_flag {
-		err = errors.New("Invalid key(s) found.")
-	}
-	return list, err
+	return diags, nil
 }
 
 // CheckKeyUnicity()
 //
-// Parse all keys/conditional statements from a slice of tokens (use ParseInSlice() or FuzzyParseInSlice())
-// and returns an error if they are non unique plus a list of non unique token keys if any.
+// Parse all keys/conditional statements from a slice of tokens (use ParseTokens())
+// and returns a diagnostic for each repeated occurrence of a key/conditional statement.
 // Would make sense to be ran after CheckKeyValidity()()
-// If err is nil then all is good.
-func (v *VDFFile) CheckKeyUnicity(tokens [][]string) (list []string, err error) {
+// err != nil only in case of processing failure.
+func (v *VDFFile) CheckKeyUnicity(tokens []Token) (diags Diagnostics, err error) {
 	v.log(fmt.Sprintf("CheckKeyUnicity()"))
 
-	// Move slice in a map and count occurrences
+	// Move slice in a map and keep the first occurrence
 	// map key is string key + conditional statement
-	s := make(map[string]int)
+	first := make(map[string]Token)
 
 	for _, tkn := range tokens {
-		s[tkn[1]+tkn[3]]++
-	}
-
-	// Now builds a list of keys for which unicity is broken if any
-	err_flag := false
-	for k, v := range s {
-		if v > 1 {
-			list = append(list, k)
-			err_flag = true
+		if f, ok := first[tkn.Key+tkn.Cond]; ok {
+			msg := fmt.Sprintf("Non unique key %q%s - first defined at %s", tkn.Key, tkn.Cond, f.Pos())
+			diags = append(diags, newDiagnostic(RuleKeyUnicity, SeverityError, tkn, msg, "Remove or rename one of the occurrences."))
+		} else {
+			first[tkn.Key+tkn.Cond] = tkn
 		}
 	}
 
-	if err_flag {
-		err = errors.New("Non unique key(s)")
-	}
-	return list, err
+	return diags, nil
 }
 
 // CheckIsolatedConditionalStatements()
 //
 // Search in a byte buffer for isolated conditional statements which is an invalid VDF form.
 // Would make sense to be ran after CheckKeyValidity()()
-func (v *VDFFile) CheckIsolatedConditionalStatements(buf []byte) (list []string, err error) {
+// err != nil only in case of processing failure.
+func (v *VDFFile) CheckIsolatedConditionalStatements(buf []byte) (diags Diagnostics, err error) {
 	v.log(fmt.Sprintf("CheckIsolatedConditionalStatements()"))
 
-	// Look for occurrences of isolated conditional statements
-	regex := `(?mi)^[ \t]*(\[[^\]]*\])`
-	pattern, err := regexp.Compile(regex)
-	vals := pattern.FindAllSubmatch(buf, -1)
-	if err != nil {
-		return list, fmt.Errorf("Err in regEx: %v", err)
-	}
-	err_flag := false
-	for _, v := range vals {
-		list = append(list, string(v[0]))
-		err_flag = true
-	}
-
-	if err_flag {
-		err = errors.New("Isolated conditional statement(s) found.")
+	// Look for conditional statements the parser couldn't attach to a value
+	_, perr := ParseFile(v.fileName, buf)
+	errs, _ := perr.(SyntaxErrors)
+
+	for _, e := range errs {
+		if e.Kind == SyntaxIsolatedCond {
+			diags = append(diags, Diagnostic{
+				Rule:     RuleIsolatedCond,
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("Isolated conditional statement %s", e.Text),
+				Span:     textSpan(e.Pos, e.Text),
+				Fix:      "Move the conditional statement to the end of the line of the token it applies to.",
+			})
+		}
 	}
 
-	return list, err
+	return diags, nil
 }
 
 // ConvVdf2json   VDF -> JSON
 //
 //  Output converted content to File writer (e.g. Stdout)
 //  Output encoding: utf8 
+//  Legacy format kept for compatibility, see WriteJSON() for the versioned schema.
 func (v *VDFFile) ConvVdf2json(out *os.File) (err error) {
+	return v.ConvVdf2jsonWriter(out)
+}
+
+// ConvVdf2jsonWriter   VDF -> JSON
+//
+//  Same as ConvVdf2json() with any writer.
+func (v *VDFFile) ConvVdf2jsonWriter(out io.Writer) (err error) {
 	v.log(fmt.Sprintf("ConvVdf2json()"))
 
 	filename := v.fileName
 
-	// Parse tokens
-	buf, err := v.ReadSource()
+	doc, err := v.tree()
 	if err != nil {
 		return (fmt.Errorf("Error accessing file %s - %v", filename, err))
 	}
 
-	bHeader, err := v.GetHeader(buf)
-	if err != nil {
-		return (fmt.Errorf("Error reading file header %s - %v", filename, err))
-	}
-	header := string(bHeader)
-	footer := strings.Repeat("}\r\n", strings.Count(header, "{")) // Build footer by counting the number of opening brackets in header
-
-	res, err := v.SkipHeader(buf)
-	if err != nil {
-		return (fmt.Errorf("Error reading vdf header of %s - %v", filename, err))
+	// Everything around the content of the tokens section is kept as is in the header
+	// and the footer: other sections, nested sections, etc.
+	section := tokensSection(doc)
+	header, footer := "", ""
+	if section.Type == NodeSection {
+		header, footer = textAround(doc, section)
 	}
 
-	tokens, err := v.ParseInSlice(res)
-	if err != nil {
-		return (fmt.Errorf("Error parsing vdf of %s - %v", filename, err))
+	var tokens [][]string
+	keep := v.GetKeepSourceTokenFlag()
+	for _, n := range section.Children {
+		switch n.Type {
+		case NodeSection:
+			return fmt.Errorf("Error converting vdf to json %s - section %s nested in %s can't be converted", filename, n.Key, section.Key)
+		case NodePair:
+			if !isSourceKey(n.Key) || keep {
+				tokens = append(tokens, []string{n.lineText(), n.Key, n.Value, n.Cond, n.Comment})
+			}
+		}
 	}
 
 	fileEncoding := v.GetEncoding()
@@ -325,92 +350,64 @@ func conv2json(key, value string) (line string, err error) {
 }
 
 
+// splitJsonKey()
+//
+// Splits a json key in vdf key and conditional statement e.g. a_key[[$WIN32]] -> a_key, [$WIN32]
+//
+func splitJsonKey(key string) (justThekey, condStatement string, err error) {
+	i := strings.LastIndex(key, "[[")
+	if i < 0 || !strings.HasSuffix(key, "]]") { // No conditional statement
+		return key, "", nil
+	}
+	if i == 0 {
+		return "", "", fmt.Errorf("Error in data: key with just a conditional statement %s", key)
+	}
+	condStatement = key[i+1 : len(key)-1]
+	if _, err = ParseCond(condStatement); err != nil {
+		return "", "", fmt.Errorf("Error in data: key %s - %v", key, err)
+	}
+	return key[:i], condStatement, nil
+}
+
 // ConvJson2Vdf   JSON -> VDF
 //
-//	input: name/path of json file
-//  output: converted content to File writer (e.g. Stdout)
+//	input: name/path of json file, versioned schema or legacy format (see ReadJSON())
+//  output: converted content to File writer (e.g. Stdout) in the encoding of the json
 func ConvJson2Vdf(jsonfile string, out *os.File) (err error) {
-	// v.log(fmt.Sprintf("onvVdf2Json()"))
-
 	f, err := os.Open(jsonfile)
 	if err != nil {
 		return fmt.Errorf("Unable to open json file %s - %v", jsonfile, err)
 	}
-	
-	dec := json.NewDecoder(bufio.NewReader(f))
-
-	// Build a list of tokens (following json order)
-	var list [][]string   // will store the actual file data 
-	idx := 0
-	var key string
-	var fileEncoding, header, footer string  // we'll capture them on the fly
-	for {
-		tkn, err := dec.Token()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("Error decoding json file %s - %v", tkn, err)
-		}
-		switch tkn.(type) {
-        case string:
-			if idx % 2 == 0 {
-				key = tkn.(string)
-			} else {
-				switch key {
-				case "!vdf file encoding!":
-					fileEncoding = tkn.(string)
-				case "!vdf file header!":
-					header = tkn.(string)
-				case "!vdf file footer!":
-					footer = tkn.(string)
-				default:
-					list = append(list, [][]string{{key, tkn.(string)}}...)
-				}
-			}
-			idx++
-        default:
-            // Ignore
-        }
+	defer f.Close()
+
+	return convJson2Vdf(f, jsonfile, out)
+}
+
+// ConvJson2VdfWriter   JSON -> VDF
+//
+//	Same as ConvJson2Vdf() with any reader and writer.
+func ConvJson2VdfWriter(in io.Reader, out io.Writer) (err error) {
+	return convJson2Vdf(in, "-", out)
+}
+
+// convJson2Vdf()
+//
+// Read a json file (see ReadJSON()) and write it as VDF in its encoding.
+// name is the name of the json used in messages.
+//
+func convJson2Vdf(in io.Reader, name string, out io.Writer) (err error) {
+	c, err := readJSON(in, name)
+	if err != nil {
+		return fmt.Errorf("Error decoding json file %s - %v", name, err)
 	}
-	// fmt.Printf("enc=%s\n",fileEncoding)
 
 	// Output strings
-	u, err := NewUTFConvWriter(out, fileEncoding) // Manages encoding
+	u, err := NewUTFWriter(out, c.encoding) // Manages encoding
 	if err != nil {
-		return fmt.Errorf("Error setting encoding for vdf output %s - %v", fileEncoding, err)
+		return fmt.Errorf("Error setting encoding for vdf output %s - %v", c.encoding, err)
 	}
-	
-	u.Write([]byte(header))
-	u.Write([]byte("\r\n"))
-	u.Write([]byte("\r\n"))
-	
-	for _,v := range list {
-		u.Write([]byte("\""))
-		i := strings.Index(v[0], "[[$")  // Looks for a connditional statement
-		var condStatement, justThekey string
-		switch {
-		case i == 0:
-			return fmt.Errorf("Error in data: key with just a conditional statement %s", v[0])
-		case i <0: // No conditional statement
-			justThekey = v[0]
-		case i > 0:
-			justThekey = v[0][:i]
-			condStatement = v[0][i+1 : len(v[0]) - 1]
-		}
-		u.Write([]byte(justThekey))
-		u.Write([]byte("\"\t\""))
-		u.Write([]byte(v[1]))
-		u.Write([]byte("\""))
-		if len(condStatement) > 0 {
-			u.Write([]byte("\t"))
-			u.Write([]byte(condStatement))		
-		}
-		u.Write([]byte("\r\n"))
+	if _, err = c.doc.WriteTo(u); err != nil {
+		return err
 	}
-	
-	u.Write([]byte("\r\n"))
-	u.Write([]byte(footer))
-
-	return nil
+	return u.Flush()
 }
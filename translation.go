@@ -0,0 +1,176 @@
+package vdfloc
+
+// Translation units shared by the exchange formats (XLIFF, gettext, etc.)
+//
+// A unit is a token variant of the english file (key + conditional statement)
+// along with its translation in a loc file. Values are decoded (see Unescape()):
+// translators see line breaks and quotes rather than escape sequences.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// translationUnit is a token variant of the english file along with its translation.
+type translationUnit struct {
+	Key          string
+	Line         int    // Line of the english token, 0 if unknown
+	Cond         string // As written in the english file
+	Source       string // English value, decoded
+	Target       string // Translation, decoded
+	Translated   bool   // The loc file holds the variant
+	Outdated     bool   // The [english] value kept in the loc file differs from the english file
+	PrevSource   string // [english] value kept in the loc file if outdated, decoded
+	Comment      string // Trailing comment of the english token without //
+	PluralGender string // Plural/gender suffix of the key e.g. :p, empty if none
+}
+
+// translationUnits()
+//
+// Returns the units of the english file in file order with their translation
+// in the loc file if any (target may be nil). Variants are matched on their
+// normalised conditional statement (see normalizedCond()).
+//
+func translationUnits(en, target *VDFFile) (units []translationUnit, err error) {
+	enDoc, err := en.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)  // key + cond -> translation
+	sources := make(map[string]string) // key + cond -> [english] value of the loc file
+	if target != nil {
+		doc, err := target.tree()
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range tokenPairs(doc) {
+			values[n.Key+normalizedCond(n.Cond)] = n.Value
+		}
+		for _, n := range doc.Pairs() {
+			if isSourceKey(n.Key) {
+				sources[strings.TrimPrefix(n.Key, "[english]")+normalizedCond(n.Cond)] = n.Value
+			}
+		}
+	}
+
+	for _, n := range tokenPairs(enDoc) {
+		u := translationUnit{
+			Key:          n.Key,
+			Line:         n.Span.Start.Line,
+			Cond:         n.Cond,
+			Comment:      strings.TrimSpace(strings.TrimPrefix(n.Comment, "//")),
+			PluralGender: plrGdrSuffix(n.Key),
+		}
+		u.Source, _ = Unescape(n.Value) // Invalid sequences are kept as is
+		id := n.Key + normalizedCond(n.Cond)
+		if value, ok := values[id]; ok {
+			u.Target, _ = Unescape(value)
+			u.Translated = true
+			if source, ok := sources[id]; ok && source != n.Value {
+				u.Outdated = true
+				u.PrevSource, _ = Unescape(source)
+			}
+		}
+		units = append(units, u)
+	}
+	return units, nil
+}
+
+// mergeTranslations()
+//
+// Set the translated units in the tree of the instance. Existing variants are updated
+// in place; missing ones are inserted after the variant of the previous unit found in
+// the file, at the end of the tokens section otherwise, so that the english order is kept.
+// Units without target are ignored. Returns the number of variants added or modified.
+//
+func (v *VDFFile) mergeTranslations(units []translationUnit) (merged int, err error) {
+	doc, err := v.tree()
+	if err != nil {
+		return 0, err
+	}
+
+	nodes := make(map[string]*Node) // key + cond -> variant
+	for _, n := range tokenPairs(doc) {
+		nodes[n.Key+normalizedCond(n.Cond)] = n
+	}
+
+	var prev *Node
+	for _, u := range units {
+		if len(u.Key) == 0 {
+			return merged, fmt.Errorf("Translation without key")
+		}
+		id := u.Key + normalizedCond(u.Cond)
+		n := nodes[id]
+
+		if u.Translated {
+			switch {
+			case n == nil:
+				n = NewPair(u.Key, Escape(u.Target))
+				n.Cond = normalizeCond(u.Cond)
+				if prev != nil {
+					prev.parent.Insert(prev.parent.IndexOf(prev)+1, n)
+				} else {
+					tokensSection(doc).Append(n)
+				}
+				nodes[id] = n
+				merged++
+			default:
+				if current, _ := Unescape(n.Value); current != u.Target { // Keep the escape sequences as written if unchanged
+					n.Value = Escape(u.Target)
+					merged++
+				}
+			}
+		}
+		if n != nil {
+			prev = n
+		}
+	}
+	return merged, nil
+}
+
+// plrGdrSuffix returns the plural/gender suffix of a key (e.g. :p, :gp), empty if none
+func plrGdrSuffix(key string) string {
+	if m := rePlrGdrKey.FindStringSubmatch(key); len(m) > 1 {
+		if _, ok := m_pluralGender[m[1]]; ok {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// fileLanguage()
+//
+// Returns the language of a file: the one declared in its header, or else
+// the one of its file name. ok == false if neither is known.
+//
+func (v *VDFFile) fileLanguage() (lang Language, ok bool) {
+	if doc, err := v.tree(); err == nil {
+		if lang, err := languageFromHeader(doc, v.pluralGenderConfig()); err == nil {
+			return lang, true
+		}
+	}
+	if lang, err := LanguageFromFileName(v.fileName); err == nil {
+		return lang, true
+	}
+	return lang, false
+}
+
+// checkLanguage()
+//
+// Check that a language tag of an exchange file (e.g. pt_BR or pt-BR, empty if not set)
+// is the language of the file (see fileLanguage()). from names the exchange file in errors.
+//
+func (v *VDFFile) checkLanguage(tag string, from string) error {
+	if len(tag) == 0 {
+		return nil
+	}
+	lang, ok := v.LookupLanguage(strings.Replace(tag, "_", "-", -1)) // gettext uses _
+	if !ok {
+		return fmt.Errorf("Unknown language %s in the %s file", tag, from)
+	}
+	if fileLang, ok := v.fileLanguage(); ok && fileLang.Name != lang.Name {
+		return fmt.Errorf("Language of the %s file (%s) doesn't match the language of %s (%s)", from, tag, v.fileName, fileLang.Name)
+	}
+	return nil
+}
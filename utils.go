@@ -1,6 +1,7 @@
 package vdfloc
 
 import (
+	"bufio"
 	"fmt"
 	"errors"
 	"io"
@@ -32,6 +33,7 @@ const utf8ProbeLen = 4 * 32 * 1024 // probe length: if this length utf8 then the
 // 		Keep the original source mechanics. Modifications are:
 //			- Added 1 output param: input file encoding detected.
 //			- Falls back to utf8 (not OS dependent)
+//			- Works on any reader (see NewUTFReader())
 // The output io.Reader skips the BOM
 // If file starts with BOM (utf-8 utf-16LE utf-16BE utf-32LE utf-32BE) then BOM is used.
 // If no BOM and encodingName is "" empty then file content probed to see is it already utf-8.
@@ -43,31 +45,40 @@ func UTFReader(f *os.File, encodingName string) (r io.Reader, encodingFound stri
 	if f == nil {
 		return nil, encodingFound, errors.New("invalid (nil) source file")
 	}
+	return NewUTFReader(f, encodingName)
+}
 
-	// detect BOM
-	bom := make([]byte, utf8.UTFMax)
+// NewUTFReader()
+// Same as UTFReader() for any reader: the encoding is detected on a buffered peek
+// of the beginning of the content so the source doesn't need to support Seek().
+//
+func NewUTFReader(src io.Reader, encodingName string) (r io.Reader, encodingFound string, err error) {
 
-	nBom, err := f.Read(bom)
-	if err != nil {
-		if nBom == 0 && err == io.EOF { // empty file: retrun source file as is
-			return f, encodingFound, nil
-		}
+	// validate parameters
+	if src == nil {
+		return nil, encodingFound, errors.New("invalid (nil) source reader")
+	}
+
+	f := bufio.NewReaderSize(src, utf8ProbeLen+utf8.UTFMax)
+
+	// detect BOM
+	bom, err := f.Peek(utf8.UTFMax)
+	nBom := len(bom)
+	if err != nil && err != io.EOF {
 		return nil, encodingFound, errors.New("file read error: " + err.Error())
 	}
+	if nBom == 0 { // empty file: retrun source file as is
+		return f, encodingFound, nil
+	}
 
 	// if utf-8 BOM then skip it and return source file
 	if nBom >= len(Utf8bom) && bom[0] == Utf8bom[0] && bom[1] == Utf8bom[1] && bom[2] == Utf8bom[2] {
-		if _, err := f.Seek(int64(len(Utf8bom)), 0); err != nil {
-			return nil, encodingFound, errors.New("file seek error: " + err.Error())
+		if _, err := f.Discard(len(Utf8bom)); err != nil {
+			return nil, encodingFound, errors.New("file read error: " + err.Error())
 		}
 		return f, "UTF8BOM", nil
 	}
 
-	// move back to the file begining to use BOM, if present
-	if _, err := f.Seek(0, 0); err != nil {
-		return nil, encodingFound, errors.New("file seek error (moving back) " + err.Error())
-	}
-
 	// ambiguous utf-16LE and utf32-LE detection: assume utf-32LE because 00 00 is very unlikely in text file
 	if nBom >= len(Utf32LEbom) && bom[0] == Utf32LEbom[0] && bom[1] == Utf32LEbom[1] && bom[2] == Utf32LEbom[2] && bom[3] == Utf32LEbom[3] {
 		return transform.NewReader(f, utf32.UTF32(utf32.LittleEndian, utf32.UseBOM).NewDecoder()), "UTF32LE", nil
@@ -86,15 +97,12 @@ func UTFReader(f *os.File, encodingName string) (r io.Reader, encodingFound stri
 	// encoding not specified then probe file to check is it utf-8
 	if encodingName == "" {
 
-		// read probe bytes from the file
-		buf := make([]byte, utf8ProbeLen)
-		nProbe, err := f.Read(buf)
-		if err != nil {
-			if nProbe == 0 && err == io.EOF { // empty file: retrun source file as is
-				return f, "UTF32LE", nil
-			}
+		// peek probe bytes from the file
+		buf, err := f.Peek(utf8ProbeLen)
+		if err != nil && err != io.EOF {
 			return nil, encodingFound, errors.New("file read error: " + err.Error())
 		}
+		nProbe := len(buf)
 
 		// check if all runes are utf-8
 		nPos := 0
@@ -107,11 +115,6 @@ func UTFReader(f *os.File, encodingName string) (r io.Reader, encodingFound stri
 			buf = buf[n:]
 		}
 
-		// move back to the file begining
-		if _, err := f.Seek(0, 0); err != nil {
-			return nil, encodingFound, errors.New("file seek error: " + err.Error())
-		}
-
 		// file is utf-8 if:
 		// all runes are utf-8 and file size less than max probe size or file size excceeds probe size
 		if nPos >= nProbe || nPos >= utf8ProbeLen-utf8.UTFMax {
@@ -167,43 +170,88 @@ func UTF8Conv(buf []byte, encodingName string) (out []byte, err error) {
 	return append(bom,out...), nil
 }
 
+// checkEncodingName()
+// Returns an error if an encoding name is not supported by NewUTFConvWriter().
+// An empty name is accepted (no conversion).
+//
+func checkEncodingName(encodingName string) error {
+	switch strings.ToLower(encodingName) {
+	case "", "utf8", "utf8bom", "utf16le", "utf16be", "utf32le", "utf32be":
+		return nil
+	}
+	return fmt.Errorf("Unsupported encoding %s", encodingName)
+}
+
 type UTF8Enc struct {
 	encoding    string		// "UTF8", "UTF8BOM", etc.
 	utfEncoder	*encoding.Encoder
-	f           *os.File
+	w           io.Writer
 	ioName		string      // file, stdout, etc.
+	pending     []byte      // Incomplete utf8 sequence at the end of the last Write()
 }
 // Create a new instance
 // - In: File (nil for stdout) and encoding
 // - Returns instance and error code
 func NewUTFConvWriter(f *os.File, encodingName string) (u *UTF8Enc, err error) {
 
-	u = &UTF8Enc{} // Create instance
-
 	if f == nil {
 		// Stdout
-		u.f = os.Stdout
+		f = os.Stdout
+	}
+
+	u, err = NewUTFWriter(f, encodingName)
+	if err != nil {
+		return nil, err
 	}
-	u.f = f
 	u.ioName = f.Name()
 
+	return u, nil
+}
+
+// NewUTFWriter()
+// Same as NewUTFConvWriter() for any writer.
+// The BOM (if any) is written straight away.
+//
+func NewUTFWriter(w io.Writer, encodingName string) (u *UTF8Enc, err error) {
+
+	if w == nil {
+		return nil, errors.New("invalid (nil) writer")
+	}
+
+	u = &UTF8Enc{} // Create instance
+	u.w = w
+	u.encoding = encodingName
+
 	var enc encoding.Encoding
+	var bom []byte
 
 	// fmt.Printf("enc=%s, outname=%s\n",encodingName, u.ioName)
 
 	switch strings.ToLower(encodingName) {
 	case "utf8":
 	case "utf8bom":
-		f.Write([]byte{0xEF, 0xBB, 0xBF})		// printout a BOM
+		bom = Utf8bom		// printout a BOM
 	case "utf16le":
-		f.Write([]byte{0xFF, 0xFE})  			// printout a BOM
+		bom = Utf16LEbom  	// printout a BOM
 		enc = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM )
 	case "utf16be":
-		f.Write([]byte{0xFE, 0xFF})			// printout a BOM
+		bom = Utf16BEbom	// printout a BOM
 		enc = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM )
+	case "utf32le":
+		bom = Utf32LEbom	// printout a BOM
+		enc = utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM)
+	case "utf32be":
+		bom = Utf32BEbom	// printout a BOM
+		enc = utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM)
 	default:
 	}
 
+	if len(bom) > 0 {
+		if _, err = w.Write(bom); err != nil {
+			return nil, fmt.Errorf("Unable to write: %v", err)
+		}
+	}
+
 	if enc != nil {
 		u.utfEncoder = enc.NewEncoder()
 	}
@@ -216,27 +264,75 @@ func NewUTFConvWriter(f *os.File, encodingName string) (u *UTF8Enc, err error) {
 // Convert a UTF8 buffer to UTF16BE or LE
 //	encodingName can be UTF16LE, UTF16BE, UTF8BOM, UTF8
 // 	if encoding name is UTF8 or UTF8BOM skip the convertion
-// Returns the number of bytes writen
+// Returns the number of bytes of buf writen (io.Writer compliant)
+// A character split between two calls is kept until the next one (or Flush()/Close())
+// so that it's converted whole.
 //
 func (u *UTF8Enc) Write(buf []byte) (n int, err error) {
-	var out []byte
-	if u.utfEncoder != nil {
-		out, err = u.utfEncoder.Bytes(buf)
-		if err != nil {
-			return 0, fmt.Errorf("Unable to convert %v - %v", buf, err)
+	if u.utfEncoder == nil {
+		if _, err = u.w.Write(buf); err != nil {
+			return 0, fmt.Errorf("Unable to write: %v", err)
 		}
-	} else {
-		out = buf
+		return len(buf), nil
 	}
-	n, err = u.f.Write(out)
+
+	data := append(u.pending, buf...)
+	u.pending = nil
+	if i := incompleteRuneStart(data); i >= 0 {
+		u.pending = append([]byte(nil), data[i:]...)
+		data = data[:i]
+	}
+	if err = u.encode(data); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// incompleteRuneStart returns the offset of the incomplete utf8 sequence ending buf, -1 if none
+func incompleteRuneStart(buf []byte) int {
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				return i
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+func (u *UTF8Enc) encode(buf []byte) (err error) {
+	if len(buf) == 0 {
+		return nil
+	}
+	out, err := u.utfEncoder.Bytes(buf)
 	if err != nil {
-		return 0, fmt.Errorf("Unable to write: %v", err)
+		return fmt.Errorf("Unable to convert %v - %v", buf, err)
 	}
-	return n, nil	
+	if _, err = u.w.Write(out); err != nil {
+		return fmt.Errorf("Unable to write: %v", err)
+	}
+	return nil
+}
+
+// Flush()
+// Write the incomplete character kept by the last Write() if any (invalid utf8).
+//
+func (u *UTF8Enc) Flush() (err error) {
+	pending := u.pending
+	u.pending = nil
+	return u.encode(pending)
 }
 
 // Close()
-// 
+// Flush then close the underlying writer if it can be closed.
+//
 func (u *UTF8Enc) Close() (err error) {
-	return u.f.Close()
+	if err = u.Flush(); err != nil {
+		return err
+	}
+	if c, ok := u.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
 }
@@ -0,0 +1,59 @@
+package vdfloc
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestUTFWriterSplitRunes(t *testing.T) {
+	const text = "\"a\"\t\"Bé € 😀 ok\"\n"
+	for _, enc := range []string{"UTF8", "UTF8BOM", "UTF16LE", "UTF16BE", "UTF32LE", "UTF32BE"} {
+		var whole bytes.Buffer
+		u, err := NewUTFWriter(&whole, enc)
+		if err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		u.Write([]byte(text))
+		u.Flush()
+
+		var split bytes.Buffer
+		u, _ = NewUTFWriter(&split, enc)
+		if _, err = io.Copy(u, iotest.OneByteReader(strings.NewReader(text))); err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		if err = u.Flush(); err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		if !bytes.Equal(whole.Bytes(), split.Bytes()) {
+			t.Errorf("%s: one byte writes give % x, want % x", enc, split.Bytes(), whole.Bytes())
+		}
+
+		// Read back
+		r, _, err := NewUTFReader(bytes.NewReader(split.Bytes()), "")
+		if err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		back, _ := io.ReadAll(r)
+		if string(back) != text {
+			t.Errorf("%s: read back %q, want %q", enc, back, text)
+		}
+	}
+}
+
+func TestUTFWriterFlushInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	u, _ := NewUTFWriter(&buf, "UTF16LE")
+	u.Write([]byte("a\xe2\x82")) // Truncated €
+	if got := buf.Len(); got != 2+2 {
+		t.Errorf("before Flush(): %d bytes written, want BOM + a", got)
+	}
+	if err := u.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte{0xfd, 0xff}) {
+		t.Errorf("Flush() wrote % x, want a replacement character", buf.Bytes())
+	}
+}
@@ -1,128 +1,300 @@
-package vdfloc
-
-// Package vdfloc
-//	Toolbox of functions to deal with valve vdf loc files
-//	Compatible with utf8 and utf16BE encoding
-
-import (
-	"fmt"
-	"io"
-	"log"
-	"os"
-	"path/filepath"
-	"time"
-)
-
-type VDFFile struct {
-	pathAndName string // loc file path and name
-	fileName    string
-	f           *os.File
-	encoding    string
-	logWriter   io.Writer
-	sourceTkn   bool // Define whether we keep the [english] tokens or not
-	maxKeyLen	int  // Maximum autorised char length of keys
-	// cParenth     []byte
-	// cDbleQuote   []byte
-	// cDbleSlash   []byte
-	// cBackSlash   []byte
-	// cLineFeed    []byte
-	// cCarriageRet []byte
-	// cCRLF        []byte
-	// cTab         []byte
-	// bom          []byte
-}
-
-var g_debug bool
-var g_logWriter io.Writer
-
-// Create a new instance
-// - In: File name and path
-// - Returns instance and error code
-func New(filePathAndName string) (*VDFFile, error) {
-
-	// validate parameter
-	if filePathAndName == "" {
-		return nil, fmt.Errorf("File name cannot be empty")
-	}
-
-	v := &VDFFile{} // Create instance
-
-	var err error
-	v.pathAndName = filePathAndName
-	v.fileName = filepath.Base(filePathAndName)
-	v.logWriter = g_logWriter
-	v.sourceTkn = false // default behavior: we ignore tokens names including "[english]"
-	v.maxKeyLen = 120    // characters - default maximum autorised length for keys
-
-	// Open the file for reading
-	v.f, err = os.Open(filePathAndName)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to open file %s - %v", filePathAndName, err)
-	}
-
-	// Default encoding: utf8 no bom
-	// v.cParenth = []byte{'{'}
-	// v.cDbleQuote = []byte{'"'}
-	// v.cDbleSlash = []byte{'/', '/'}
-	// v.cTab = []byte{'\t'}
-	// v.cBackSlash = []byte{'\\'}
-	// v.cLineFeed, v.cCarriageRet = []byte{'\n'}, []byte{'\r'}
-	// v.cCRLF = append([]byte{'\r'}, []byte{'\n'}...)
-
-	return v, nil
-}
-
-// Release instance
-// Close the file and release the structure.
-func Close(v *VDFFile) (err error) {
-	err = v.f.Close()
-	v = nil
-	return err
-}
-
-// Set the flag to keep token names with [english] tag
-func (v *VDFFile) SetKeepSourceTokens() {
-	v.sourceTkn = true
-}
-
-// Reset the flag to filter out token names with [english] tag
-func (v *VDFFile) ResetKeepSourceTokens() {
-	v.sourceTkn = false
-}
-
-// Read the flag to keep (true) or filter (flase) token names with [english] tag
-func (v *VDFFile) GetKeepSourceTokenFlag() bool {
-	return v.sourceTkn
-}
-
-// Set max autorised char key length
-func (v *VDFFile) SetMaxKeyLen(val int) {
-	v.maxKeyLen = val
-}
-
-// Read max autorised char key length
-func (v *VDFFile) ReadMaxKeyLen() int {
-	return v.maxKeyLen
-}
-
-// SetDebug()
-//
-// Enable or disable log for all instances created from this point
-// Traces errors if it's set to true.
-func SetDebug(debug bool, logWriter io.Writer) {
-	g_debug = debug
-	g_logWriter = logWriter
-}
-
-// Log writer
-func (v *VDFFile) log(a interface{}) {
-	if g_debug {
-		if v.logWriter != nil {
-			timestamp := time.Now().Format(time.RFC3339)
-			msg := fmt.Sprintf("%v: %v", timestamp, a)
-			fmt.Fprintln(v.logWriter, msg)
-		} else {
-			log.Println(a)
-		}
-	}
-}
+package vdfloc
+
+// Package vdfloc
+//	Toolbox of functions to deal with valve vdf loc files
+//	Compatible with utf8 and utf16BE encoding
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/fabdem/go-vdfloc/config"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type VDFFile struct {
+	pathAndName string // loc file path and name
+	fileName    string
+	f           *os.File
+	open        func() (io.ReadCloser, error) // Opens the source for reading
+	isFile      bool                          // Source is a file on disk that Save() can overwrite
+	fsys        fs.FS                         // File system holding the files referenced by #base/#include, nil if unknown
+	fsName      string                        // Name of the file in fsys
+	encoding    string
+	debug       bool // Traces enabled
+	logWriter   io.Writer
+	conf        *config.Config // Plural/gender definitions
+	sourceTkn   bool           // Define whether we keep the [english] tokens or not
+	maxKeyLen   int            // Maximum autorised char length of keys
+	allowedTags []string       // Markup tags accepted in values, nil for the default ones
+	mu          sync.Mutex     // Protects the loading of the tree, the encoding and the settings
+	doc         *Node          // KeyValues tree, nil until the source is parsed
+	syntaxErr   error          // Syntax errors found while parsing the source
+	// cParenth     []byte
+	// cDbleQuote   []byte
+	// cDbleSlash   []byte
+	// cBackSlash   []byte
+	// cLineFeed    []byte
+	// cCarriageRet []byte
+	// cCRLF        []byte
+	// cTab         []byte
+	// bom          []byte
+}
+
+// Options are the settings of an instance.
+// Zero fields take the package defaults (see SetDebug() and LoadJsonConf()).
+type Options struct {
+	Logger             io.Writer      // Enables traces to this writer
+	PluralGenderConfig *config.Config // Plural/gender definitions by language
+	KeepSourceTokens   bool           // Keep the token names with [english] tag
+	MaxKeyLen          int            // Maximum autorised char length of keys
+	AllowedTags        []string       // Markup tags accepted in values (see DefaultAllowedTags())
+}
+
+// Package defaults for the instances created without options.
+// Only modified through SetDebug() and LoadJsonConf(). They are copied in each instance
+// when it's created: changing them afterwards doesn't affect the instances already created.
+var defaults struct {
+	sync.RWMutex
+	debug     bool
+	logWriter io.Writer
+	conf      *config.Config
+}
+
+// Instances are independent from each other and can be used from different goroutines.
+// An instance can be shared by goroutines reading it; edits have to be synchronised by the caller.
+
+// Create a new instance
+// - In: File name and path, options (optional)
+// - Returns instance and error code
+func New(filePathAndName string, opts ...Options) (*VDFFile, error) {
+
+	// validate parameter
+	if filePathAndName == "" {
+		return nil, fmt.Errorf("File name cannot be empty")
+	}
+
+	v := newInstance(filePathAndName, opts)
+
+	var err error
+	v.open = func() (io.ReadCloser, error) { return os.Open(filePathAndName) }
+	v.isFile = true
+	v.fsys, v.fsName = os.DirFS(filepath.Dir(filePathAndName)), filepath.Base(filePathAndName)
+
+	// Open the file for reading
+	v.f, err = os.Open(filePathAndName)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open file %s - %v", filePathAndName, err)
+	}
+
+	// Default encoding: utf8 no bom
+	// v.cParenth = []byte{'{'}
+	// v.cDbleQuote = []byte{'"'}
+	// v.cDbleSlash = []byte{'/', '/'}
+	// v.cTab = []byte{'\t'}
+	// v.cBackSlash = []byte{'\\'}
+	// v.cLineFeed, v.cCarriageRet = []byte{'\n'}, []byte{'\r'}
+	// v.cCRLF = append([]byte{'\r'}, []byte{'\n'}...)
+
+	return v, nil
+}
+
+// NewFromBytes()
+//
+// Create a new instance from a buffer holding the content of a loc file (any supported encoding).
+// name is used for file name related functions (e.g. GetEnFileName()) and positions.
+// The buffer is copied.
+//
+func NewFromBytes(buf []byte, name string, opts ...Options) (*VDFFile, error) {
+	if name == "" {
+		return nil, fmt.Errorf("File name cannot be empty")
+	}
+
+	src := append([]byte(nil), buf...)
+
+	v := newInstance(name, opts)
+	v.open = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(src)), nil }
+	return v, nil
+}
+
+// NewFromReader()
+//
+// Create a new instance from a reader (e.g. an http request body) which is read entirely.
+// name is used for file name related functions (e.g. GetEnFileName()) and positions.
+//
+func NewFromReader(r io.Reader, name string, opts ...Options) (*VDFFile, error) {
+	if r == nil {
+		return nil, fmt.Errorf("Reader cannot be nil")
+	}
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %s - %v", name, err)
+	}
+	return NewFromBytes(buf, name, opts...)
+}
+
+// NewFromFS()
+//
+// Create a new instance from a file of a file system (e.g. embed.FS, zip.Reader, os.DirFS).
+//
+func NewFromFS(fsys fs.FS, name string, opts ...Options) (*VDFFile, error) {
+	if name == "" {
+		return nil, fmt.Errorf("File name cannot be empty")
+	}
+
+	// Make sure the file can be opened
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open file %s - %v", name, err)
+	}
+	f.Close()
+
+	v := newInstance(name, opts)
+	v.open = func() (io.ReadCloser, error) { return fsys.Open(name) }
+	v.fsys, v.fsName = fsys, name
+	return v, nil
+}
+
+// newInstance returns an instance with default settings overridden by the options if any
+func newInstance(name string, opts []Options) *VDFFile {
+	v := &VDFFile{} // Create instance
+
+	v.pathAndName = name
+	v.fileName = filepath.Base(name)
+	v.sourceTkn = false // default behavior: we ignore tokens names including "[english]"
+	v.maxKeyLen = 120   // characters - default maximum autorised length for keys
+
+	defaults.RLock()
+	v.debug = defaults.debug
+	v.logWriter = defaults.logWriter
+	v.conf = defaults.conf
+	defaults.RUnlock()
+
+	for _, o := range opts {
+		if o.Logger != nil {
+			v.debug = true
+			v.logWriter = o.Logger
+		}
+		if o.PluralGenderConfig != nil {
+			v.conf = o.PluralGenderConfig
+		}
+		if o.KeepSourceTokens {
+			v.sourceTkn = true
+		}
+		if o.MaxKeyLen > 0 {
+			v.maxKeyLen = o.MaxKeyLen
+		}
+		if o.AllowedTags != nil {
+			v.allowedTags = o.AllowedTags
+		}
+	}
+	return v
+}
+
+// Release instance
+// Close the file and release the structure.
+func Close(v *VDFFile) (err error) {
+	if v.f == nil { // already closed by Save()
+		return nil
+	}
+	err = v.f.Close()
+	v = nil
+	return err
+}
+
+// Settings can be changed while other goroutines use the instance:
+// the setters and the functions reading the settings hold v.mu.
+
+// Set the flag to keep token names with [english] tag
+func (v *VDFFile) SetKeepSourceTokens() {
+	v.mu.Lock()
+	v.sourceTkn = true
+	v.mu.Unlock()
+}
+
+// Reset the flag to filter out token names with [english] tag
+func (v *VDFFile) ResetKeepSourceTokens() {
+	v.mu.Lock()
+	v.sourceTkn = false
+	v.mu.Unlock()
+}
+
+// Read the flag to keep (true) or filter (flase) token names with [english] tag
+func (v *VDFFile) GetKeepSourceTokenFlag() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.sourceTkn
+}
+
+// Set max autorised char key length
+func (v *VDFFile) SetMaxKeyLen(val int) {
+	v.mu.Lock()
+	v.maxKeyLen = val
+	v.mu.Unlock()
+}
+
+// Read max autorised char key length
+func (v *VDFFile) ReadMaxKeyLen() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.maxKeyLen
+}
+
+// Set the markup tags accepted in values, nil for the default ones (see DefaultAllowedTags())
+func (v *VDFFile) SetAllowedTags(tags []string) {
+	v.mu.Lock()
+	v.allowedTags = tags
+	v.mu.Unlock()
+}
+
+// allowedTagList returns the markup tags accepted in values, nil for the default ones
+func (v *VDFFile) allowedTagList() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.allowedTags
+}
+
+// Set the plural/gender definitions used by this instance
+func (v *VDFFile) SetPluralGenderConfig(c *config.Config) {
+	v.mu.Lock()
+	v.conf = c
+	v.mu.Unlock()
+}
+
+// pluralGenderConfig returns the plural/gender definitions used by this instance
+func (v *VDFFile) pluralGenderConfig() *config.Config {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.conf
+}
+
+// SetDebug()
+//
+// Enable or disable log for all instances created from this point
+// without Options.Logger. The instances already created are not affected.
+// Traces errors if it's set to true.
+func SetDebug(debug bool, logWriter io.Writer) {
+	defaults.Lock()
+	defaults.debug = debug
+	defaults.logWriter = logWriter
+	defaults.Unlock()
+}
+
+// Log writer
+func (v *VDFFile) log(a interface{}) {
+	if v.debug {
+		if v.logWriter != nil {
+			timestamp := time.Now().Format(time.RFC3339)
+			msg := fmt.Sprintf("%v: %v", timestamp, a)
+			fmt.Fprintln(v.logWriter, msg)
+		} else {
+			log.Println(a)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package vdfloc
+
+// KeyValues text writer
+//
+// A parsed tree is written back byte for byte: each node keeps its source text
+// (blanks, quotes, comments) and only the pieces modified since parsing are regenerated.
+// Nodes created from scratch are written with the line breaks of the file
+// and a tab indentation matching their depth.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const defaultNewLine = "\r\n" // line break used when the tree wasn't parsed from a file
+
+type kvWriter struct {
+	w        io.Writer
+	n        int64
+	err      error
+	nl       string // line break
+	skipLead bool   // don't write the blanks before the next node
+
+	mark                *Node // section whose content is located (see textAround())
+	markOpen, markClose int64 // offsets of the content of mark
+}
+
+func (w *kvWriter) write(s string) {
+	if w.err != nil || len(s) == 0 {
+		return
+	}
+	n, err := io.WriteString(w.w, s)
+	w.n += int64(n)
+	w.err = err
+}
+
+// WriteTo()
+//
+// Write the node and its descendants in KeyValues text format (utf8).
+// Writing an unmodified parsed document reproduces the parsed buffer exactly.
+// Implements io.WriterTo.
+//
+func (n *Node) WriteTo(w io.Writer) (written int64, err error) {
+	kw := &kvWriter{w: w, nl: defaultNewLine}
+	if root := n.root(); root.raw != nil && len(root.raw.nl) > 0 {
+		kw.nl = root.raw.nl
+	}
+	kw.tree(n)
+	return kw.n, kw.err
+}
+
+// tree writes a node and its descendants, the end of the file for a document
+func (w *kvWriter) tree(n *Node) {
+	if n.Type == NodeDocument {
+		w.children(n)
+		if n.raw != nil {
+			w.write(n.raw.closeLead)
+		} else if len(n.Children) > 0 {
+			w.write(w.nl)
+		}
+	} else {
+		w.node(n, 0)
+	}
+}
+
+// Bytes()
+//
+// Returns the node and its descendants in KeyValues text format (utf8).
+//
+func (n *Node) Bytes() []byte {
+	var buf bytes.Buffer
+	n.WriteTo(&buf) // writing to a bytes.Buffer doesn't fail
+	return buf.Bytes()
+}
+
+// lineText()
+//
+// Returns the text of a node as it would be written, without the blanks before it.
+//
+func (n *Node) lineText() string {
+	var buf bytes.Buffer
+	kw := &kvWriter{w: &buf, nl: defaultNewLine, skipLead: true}
+	if root := n.root(); root.raw != nil && len(root.raw.nl) > 0 {
+		kw.nl = root.raw.nl
+	}
+	kw.node(n, 0)
+	return buf.String()
+}
+
+// textAround()
+//
+// Returns the text of a tree before the content of one of its sections, opening
+// brace included, and after it, closing brace included, as written by WriteTo().
+//
+func textAround(doc *Node, section *Node) (before, after string) {
+	var buf bytes.Buffer
+	kw := &kvWriter{w: &buf, nl: defaultNewLine, mark: section}
+	if root := doc.root(); root.raw != nil && len(root.raw.nl) > 0 {
+		kw.nl = root.raw.nl
+	}
+	kw.tree(doc)
+	return buf.String()[:kw.markOpen], buf.String()[kw.markClose:]
+}
+
+// Write()
+//
+// Write the tree of the instance (see GetTree()) to out in KeyValues text format
+// using the encoding of the file (see GetEncoding()).
+//
+func (v *VDFFile) Write(out io.Writer) (err error) {
+	v.log(fmt.Sprintf("Write()"))
+
+	doc, err := v.tree()
+	if err != nil {
+		return err
+	}
+	return v.WriteTree(doc, out)
+}
+
+// WriteTree()
+//
+// Write a tree to out in KeyValues text format using the encoding of the file
+// (see GetEncoding()). Writing an unmodified tree returned by GetTree()
+// reproduces the file exactly.
+//
+func (v *VDFFile) WriteTree(doc *Node, out io.Writer) (err error) {
+	v.log(fmt.Sprintf("WriteTree()"))
+
+	u, err := NewUTFWriter(out, v.encodingName())
+	if err != nil {
+		return fmt.Errorf("WriteTree() - %v", err)
+	}
+	if _, err = doc.WriteTo(u); err == nil {
+		err = u.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("WriteTree() - %v", err)
+	}
+	return nil
+}
+
+func (w *kvWriter) children(n *Node) {
+	for i, c := range n.Children {
+		if i > 0 && n.Children[i-1].raw == nil && c.raw != nil && !strings.Contains(c.raw.lead, "\n") {
+			// Parsed node on the same line as the previous one in the source
+			// (e.g. first node of the file): start a line after the new node
+			w.write(w.nl + w.indent(c))
+			w.skipLead = true
+		}
+		w.node(c, i)
+	}
+}
+
+// node()
+//
+// Write a node. idx is the index of the node in its parent.
+//
+func (w *kvWriter) node(n *Node, idx int) {
+	r, parsed := n.raw, n.raw != nil
+	if !parsed {
+		r = &nodeRaw{lead: w.defaultLead(n, idx)}
+	}
+	if !w.skipLead {
+		w.write(r.lead)
+	}
+	w.skipLead = false
+
+	switch n.Type {
+	case NodeComment:
+		w.piece(parsed, "", r.comment, r.origComment, n.Comment, "", formatComment, true)
+	case NodePair:
+		w.piece(parsed, "", r.key, r.origKey, n.Key, "", quote, true)
+		w.piece(parsed, r.valueSep, r.value, r.origValue, n.Value, "\t", quote, true)
+		w.piece(parsed, r.condSep, r.cond, r.origCond, n.Cond, "\t", identity, false)
+		w.piece(parsed, r.commSep, r.comment, r.origComment, n.Comment, "\t", formatComment, false)
+	case NodeSection:
+		indent := w.indent(n)
+		if parsed && len(r.key) == 0 && len(n.Key) == 0 {
+			// section without name: leave as is
+		} else {
+			w.piece(parsed, "", r.key, r.origKey, n.Key, "", quote, true)
+		}
+		w.piece(parsed, r.condSep, r.cond, r.origCond, n.Cond, " ", identity, false)
+		if parsed {
+			w.write(r.valueSep + r.value)
+		} else {
+			w.write(w.nl + indent + "{")
+		}
+		if n == w.mark {
+			w.markOpen = w.n
+		}
+		w.children(n)
+		closeLead, close := r.closeLead, r.close
+		if !parsed || (len(n.Children) > 0 && n.Children[len(n.Children)-1].raw == nil && !strings.Contains(closeLead, "\n")) {
+			closeLead = w.nl + indent // closing brace on its own line after a new node
+		}
+		if !parsed {
+			close = "}"
+		}
+		w.write(closeLead)
+		if n == w.mark {
+			w.markClose = w.n
+		}
+		w.write(close)
+	}
+}
+
+// piece()
+//
+// Write a piece of a node (key, value, etc.) preceded by its blanks:
+// as written in the source if unchanged, regenerated otherwise.
+// An empty piece is omitted unless keepEmpty is set.
+//
+func (w *kvWriter) piece(parsed bool, sep, raw, orig, cur, defSep string, format func(string) string, keepEmpty bool) {
+	if parsed && cur == orig {
+		w.write(sep + raw)
+		return
+	}
+	if len(cur) == 0 && !keepEmpty {
+		return // piece removed
+	}
+	if len(sep) == 0 {
+		sep = defSep
+	}
+	w.write(sep + format(cur))
+}
+
+// defaultLead()
+//
+// Returns the blanks to write before a node which wasn't parsed:
+// the indentation of the previous sibling if any, nothing at the start of the document,
+// otherwise a line break and one tab per level of depth.
+// The node following a new node is moved to the next line if needed (see children()).
+//
+func (w *kvWriter) defaultLead(n *Node, idx int) string {
+	p := n.parent
+	if p != nil {
+		for i := idx - 1; i >= 0; i-- {
+			if r := p.Children[i].raw; r != nil {
+				if j := strings.LastIndex(r.lead, "\n"); j >= 0 {
+					return w.nl + r.lead[j+1:]
+				}
+				break
+			}
+		}
+		if p.Type == NodeDocument && idx == 0 {
+			return ""
+		}
+	}
+	return w.nl + w.indent(n)
+}
+
+// indent returns one tab per level of depth of the node
+func (w *kvWriter) indent(n *Node) string {
+	return strings.Repeat("\t", n.Depth())
+}
+
+// root returns the top of the tree holding the node
+func (n *Node) root() *Node {
+	for n.parent != nil {
+		n = n.parent
+	}
+	return n
+}
+
+func identity(s string) string {
+	return s
+}
+
+// quote surrounds a key or value with double quotes.
+// The text is written as is: escape sequences have to be present already.
+func quote(s string) string {
+	return "\"" + s + "\""
+}
+
+// formatComment makes sure a comment starts with //
+func formatComment(s string) string {
+	if len(s) == 0 || strings.HasPrefix(s, "//") {
+		return s
+	}
+	return "// " + s
+}
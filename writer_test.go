@@ -0,0 +1,163 @@
+package vdfloc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const writerFile = `// Header comment
+
+"lang"
+{
+	"Language"	"french"
+	"Tokens"
+	{
+		// Menu
+		"a"	"A fr"	[$WIN32]	// comment
+
+		"b"  "B fr"
+		"c"	"Ligne 1
+Ligne 2"
+
+
+
+		"d"	"D fr"
+	}
+	{
+		"nameless"	"section"
+	}
+}
+`
+
+func TestWriteToUnchanged(t *testing.T) {
+	for _, nl := range []string{"\n", "\r\n"} {
+		src := strings.Replace(writerFile, "\n", nl, -1)
+		doc, _ := Parse([]byte(src)) // The nameless section is a syntax error
+		var out bytes.Buffer
+		n, err := doc.WriteTo(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != src || n != int64(len(src)) {
+			t.Errorf("%q: WriteTo() = %q (%d bytes), want the source", nl, out.String(), n)
+		}
+	}
+
+	// No trailing line break, no blank at all
+	for _, src := range []string{"\"a\" \"b\"", "\"s\"{\"a\" \"b\"}", "", "\n\n"} {
+		doc, _ := Parse([]byte(src))
+		if got := string(doc.Bytes()); got != src {
+			t.Errorf("Bytes() = %q, want %q", got, src)
+		}
+	}
+}
+
+// diffLines returns the lines of got that differ from want, both having the same number of lines
+func diffLines(t *testing.T, want, got string) (diff []string) {
+	t.Helper()
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	if len(wl) != len(gl) {
+		t.Fatalf("%d lines, want %d:\n%s", len(gl), len(wl), got)
+	}
+	for i := range wl {
+		if wl[i] != gl[i] {
+			diff = append(diff, gl[i])
+		}
+	}
+	return diff
+}
+
+func TestWriteSetOneLine(t *testing.T) {
+	for _, nl := range []string{"\n", "\r\n"} {
+		src := strings.Replace(writerFile, "\n", nl, -1)
+		doc, _ := Parse([]byte(src))
+		pair(doc, "b").Value = "B modifié"
+		pair(doc, "a").Value = "A \\\"2\\\""
+
+		diff := diffLines(t, src, string(doc.Bytes()))
+		want := []string{"\t\t\"a\"\t\"A \\\"2\\\"\"\t[$WIN32]\t// comment" + strings.TrimSuffix(nl, "\n"), "\t\t\"b\"  \"B modifié\"" + strings.TrimSuffix(nl, "\n")}
+		if strings.Join(diff, "|") != strings.Join(want, "|") {
+			t.Errorf("%q: changed lines %q, want %q", nl, diff, want)
+		}
+	}
+}
+
+func TestWriteRemovePieces(t *testing.T) {
+	doc, _ := Parse([]byte("\"a\"\t\"A\"\t[$WIN32]\t// comment\n\"b\"\t\"B\"\n"))
+	a := pair(doc, "a")
+	a.Cond, a.Comment = "", ""
+	if got, want := string(doc.Bytes()), "\"a\"\t\"A\"\n\"b\"\t\"B\"\n"; got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+
+	doc, _ = Parse([]byte("\"s\"\n{\n\t// comment\n\t\"a\"\t\"A\"\n}\n"))
+	s := doc.Sections()[0]
+	if !s.Remove(s.Children[0]) {
+		t.Fatal("Remove() = false")
+	}
+	if got, want := string(doc.Bytes()), "\"s\"\n{\n\t\"a\"\t\"A\"\n}\n"; got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteNewNodesIndentation(t *testing.T) {
+	src := "\"lang\"\r\n{\r\n    \"Tokens\"\r\n    {\r\n        \"a\"    \"A\"\r\n        \"b\"    \"B\"\r\n    }\r\n}\r\n"
+	doc, _ := Parse([]byte(src))
+	tokens := doc.Sections()[1]
+	a2 := NewPair("a2", "A2")
+	a2.Cond, a2.Comment = "[$OSX]", "new"
+	tokens.Insert(tokens.IndexOf(pair(doc, "a"))+1, a2)
+	tokens.Append(NewPair("z", "Z")) // New key at the end of the section
+
+	want := "\"lang\"\r\n{\r\n    \"Tokens\"\r\n    {\r\n        \"a\"    \"A\"\r\n" +
+		"        \"a2\"\t\"A2\"\t[$OSX]\t// new\r\n" +
+		"        \"b\"    \"B\"\r\n" +
+		"        \"z\"\t\"Z\"\r\n" +
+		"    }\r\n}\r\n"
+	if got := string(doc.Bytes()); got != want {
+		t.Errorf("Bytes() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestWriteNewTree(t *testing.T) {
+	doc := &Node{Type: NodeDocument}
+	root := NewSection("lang")
+	doc.Append(root)
+	tokens := NewSection("Tokens")
+	root.Append(NewPair("Language", "english"), tokens)
+	tokens.Append(NewComment("Menu"), NewPair("a", "A"))
+
+	want := "\"lang\"\r\n{\r\n\t\"Language\"\t\"english\"\r\n\t\"Tokens\"\r\n\t{\r\n\t\t// Menu\r\n\t\t\"a\"\t\"A\"\r\n\t}\r\n}\r\n"
+	if got := string(doc.Bytes()); got != want {
+		t.Errorf("Bytes() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestWriteInsertFirst(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"document", "\"a\"\t\"A\"\n", "\"x\"\t\"X\"\n\"a\"\t\"A\"\n"},
+		{"document with a comment", "// c\n\"a\"\t\"A\"\n", "\"x\"\t\"X\"\n// c\n\"a\"\t\"A\"\n"},
+		{"document with blank lines", "\n\n\"a\"\t\"A\"\n", "\"x\"\t\"X\"\n\n\"a\"\t\"A\"\n"},
+		{"empty document", "", "\"x\"\t\"X\""},
+		{"section", "\"s\"\n{\n\t\"a\"\t\"A\"\n}\n", "\"s\"\n{\n\t\"x\"\t\"X\"\n\t\"a\"\t\"A\"\n}\n"},
+		{"inline section", "\"s\" { \"a\" \"A\" }\n", "\"s\" {\n\t\"x\"\t\"X\"\n\t\"a\" \"A\" }\n"},
+		{"empty section", "\"s\"\n{\n}\n", "\"s\"\n{\n\t\"x\"\t\"X\"\n}\n"},
+		{"empty inline section", "\"s\" {}\n", "\"s\" {\n\t\"x\"\t\"X\"\n}\n"},
+	}
+	for _, tt := range tests {
+		doc, _ := Parse([]byte(tt.src))
+		parent := doc
+		if s := doc.Sections(); len(s) > 0 {
+			parent = s[0]
+		}
+		parent.Insert(0, NewPair("x", "X"))
+		if got := string(doc.Bytes()); got != tt.want {
+			t.Errorf("%s: Bytes() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
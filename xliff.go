@@ -0,0 +1,380 @@
+package vdfloc
+
+// XLIFF 1.2 and 2.0 export/import
+//
+// Each token variant of the english file is a unit:
+//	- id: key followed by its conditional statement if any e.g. a_key[$WIN32]
+//	- resname (1.2) / name (2.0): key
+//	- source: english value, target: translation if any (escape sequences decoded)
+//	- notes: conditional statement (from/category "condition"), comment of the english
+//	  token ("comment") and, for plural/gender keys (:p, :gp, etc.), a warning for
+//	  translators ("plural-gender", priority 1)
+// Target states: translated, needs-review-translation (1.2) / initial (2.0) if the
+// [english] value kept in the loc file differs from the english file.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// XLIFFVersion is a version of the XLIFF standard.
+type XLIFFVersion string
+
+const (
+	XLIFF12 XLIFFVersion = "1.2"
+	XLIFF20 XLIFFVersion = "2.0"
+)
+
+const (
+	xliff12NS = "urn:oasis:names:tc:xliff:document:1.2"
+	xliff20NS = "urn:oasis:names:tc:xliff:document:2.0"
+)
+
+// XLIFFFile is the content of an XLIFF file (see ImportXLIFF()).
+type XLIFFFile struct {
+	Version        XLIFFVersion
+	Original       string // Name of the english file
+	SourceLanguage string // BCP-47 tag e.g. en
+	TargetLanguage string // BCP-47 tag e.g. fr, empty if not set
+	Units          []XLIFFUnit
+}
+
+// XLIFFUnit is a translation unit: a token variant.
+type XLIFFUnit struct {
+	ID           string
+	Key          string
+	Cond         string // Conditional statement e.g. [$WIN32]
+	Source       string // English value (escape sequences decoded)
+	Target       string // Translation (escape sequences decoded), empty if none
+	State        string // State of the target as found in the file
+	PluralGender bool   // Key with a plural/gender suffix
+}
+
+// XLIFF 1.2 document
+type xliff12 struct {
+	XMLName xml.Name      `xml:"xliff"`
+	Version string        `xml:"version,attr"`
+	XMLNS   string        `xml:"xmlns,attr,omitempty"`
+	Files   []xliff12File `xml:"file"`
+}
+
+type xliff12File struct {
+	Original       string        `xml:"original,attr"`
+	SourceLanguage string        `xml:"source-language,attr"`
+	TargetLanguage string        `xml:"target-language,attr,omitempty"`
+	Datatype       string        `xml:"datatype,attr"`
+	Units          []xliff12Unit `xml:"body>trans-unit"`
+}
+
+type xliff12Unit struct {
+	ID      string         `xml:"id,attr"`
+	Resname string         `xml:"resname,attr,omitempty"`
+	Space   string         `xml:"xml:space,attr,omitempty"`
+	Source  string         `xml:"source"`
+	Target  *xliff12Target `xml:"target"`
+	Notes   []xliffNote    `xml:"note"`
+}
+
+type xliff12Target struct {
+	State string `xml:"state,attr,omitempty"`
+	Text  string `xml:",chardata"`
+}
+
+// Note of both versions: from (1.2) or category (2.0)
+type xliffNote struct {
+	From     string `xml:"from,attr,omitempty"`
+	Category string `xml:"category,attr,omitempty"`
+	Priority int    `xml:"priority,attr,omitempty"`
+	Text     string `xml:",chardata"`
+}
+
+// XLIFF 2.0 document
+type xliff20 struct {
+	XMLName xml.Name      `xml:"xliff"`
+	XMLNS   string        `xml:"xmlns,attr,omitempty"`
+	Version string        `xml:"version,attr"`
+	SrcLang string        `xml:"srcLang,attr"`
+	TrgLang string        `xml:"trgLang,attr,omitempty"`
+	Files   []xliff20File `xml:"file"`
+}
+
+type xliff20File struct {
+	ID       string         `xml:"id,attr"`
+	Original string         `xml:"original,attr,omitempty"`
+	Units    []xliff20Unit  `xml:"unit"`
+	Groups   []xliff20Group `xml:"group"`
+}
+
+type xliff20Group struct {
+	Units  []xliff20Unit  `xml:"unit"`
+	Groups []xliff20Group `xml:"group"`
+}
+
+type xliff20Unit struct {
+	ID       string           `xml:"id,attr"`
+	Name     string           `xml:"name,attr,omitempty"`
+	Notes    *xliff20Notes    `xml:"notes"` // nil if none: notes can't be empty
+	Segments []xliff20Segment `xml:"segment"`
+}
+
+type xliff20Notes struct {
+	Notes []xliffNote `xml:"note"`
+}
+
+type xliff20Segment struct {
+	State  string       `xml:"state,attr,omitempty"`
+	Source xliff20Text  `xml:"source"`
+	Target *xliff20Text `xml:"target"`
+}
+
+type xliff20Text struct {
+	Space string `xml:"xml:space,attr,omitempty"`
+	Text  string `xml:",chardata"`
+}
+
+// ExportXLIFF()
+//
+// Write the tokens of the english file with their translation in a loc file
+// (target, nil for an empty translation file) in XLIFF (see above).
+// Languages are taken from the headers or file names (BCP-47 tags).
+// err != nil if the version isn't supported or in case of processing failure.
+//
+func ExportXLIFF(en, target *VDFFile, w io.Writer, version XLIFFVersion) (err error) {
+	en.log(fmt.Sprintf("ExportXLIFF(%s, %s)", en.fileName, version))
+
+	units, err := translationUnits(en, target)
+	if err != nil {
+		return err
+	}
+
+	srcLang := "en"
+	if lang, ok := en.fileLanguage(); ok {
+		srcLang = lang.BCP47
+	}
+	trgLang := ""
+	if target != nil {
+		if lang, ok := target.fileLanguage(); ok {
+			trgLang = lang.BCP47
+		}
+	}
+
+	var doc interface{}
+	switch version {
+	case XLIFF12:
+		f := xliff12File{Original: en.fileName, SourceLanguage: srcLang, TargetLanguage: trgLang, Datatype: "plaintext"}
+		for _, u := range units {
+			x := xliff12Unit{ID: u.Key + u.Cond, Resname: u.Key, Space: "preserve", Source: u.Source, Notes: xliffNotes(u, version)}
+			if u.Translated {
+				x.Target = &xliff12Target{State: "translated", Text: u.Target}
+				if u.Outdated {
+					x.Target.State = "needs-review-translation"
+				}
+			}
+			f.Units = append(f.Units, x)
+		}
+		doc = xliff12{Version: string(version), XMLNS: xliff12NS, Files: []xliff12File{f}}
+
+	case XLIFF20:
+		f := xliff20File{ID: "f1", Original: en.fileName}
+		for _, u := range units {
+			s := xliff20Segment{State: "initial", Source: xliff20Text{Space: "preserve", Text: u.Source}}
+			if u.Translated {
+				s.Target = &xliff20Text{Space: "preserve", Text: u.Target}
+				if !u.Outdated {
+					s.State = "translated"
+				}
+			}
+			x := xliff20Unit{ID: u.Key + u.Cond, Name: u.Key, Segments: []xliff20Segment{s}}
+			if notes := xliffNotes(u, version); len(notes) > 0 {
+				x.Notes = &xliff20Notes{Notes: notes}
+			}
+			f.Units = append(f.Units, x)
+		}
+		doc = xliff20{XMLNS: xliff20NS, Version: string(version), SrcLang: srcLang, TrgLang: trgLang, Files: []xliff20File{f}}
+
+	default:
+		return fmt.Errorf("ExportXLIFF() - Unsupported XLIFF version %q", version)
+	}
+
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err = enc.Encode(doc); err != nil {
+		return fmt.Errorf("ExportXLIFF() - %v", err)
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// xliffNotes returns the notes of a unit (see above)
+func xliffNotes(u translationUnit, version XLIFFVersion) (notes []xliffNote) {
+	add := func(kind string, priority int, text string) {
+		if version == XLIFF12 {
+			notes = append(notes, xliffNote{From: kind, Priority: priority, Text: text})
+		} else {
+			notes = append(notes, xliffNote{Category: kind, Priority: priority, Text: text})
+		}
+	}
+	if len(u.Cond) > 0 {
+		add("condition", 0, u.Cond)
+	}
+	if len(u.Comment) > 0 {
+		add("comment", 0, u.Comment)
+	}
+	if len(u.PluralGender) > 0 {
+		add("plural-gender", 1, fmt.Sprintf("Plural/gender token (%s): keep the plural separators #|# and gender tags #|x|#, one form per plural/gender of the target language.", u.PluralGender))
+	}
+	return notes
+}
+
+// ImportXLIFF()
+//
+// Read an XLIFF 1.2 or 2.0 file (see above). Units without resname/name take their key
+// and conditional statement from their id. Segments of a 2.0 unit are joined.
+// See MergeXLIFF() to update a loc file.
+// err != nil if the file isn't valid XLIFF 1.2 or 2.0.
+//
+func ImportXLIFF(r io.Reader) (x *XLIFFFile, err error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("ImportXLIFF() - %v", err)
+	}
+
+	var root struct {
+		XMLName xml.Name
+		Version string `xml:"version,attr"`
+	}
+	if err = xml.Unmarshal(buf, &root); err != nil {
+		return nil, fmt.Errorf("ImportXLIFF() - Invalid XML: %v", err)
+	}
+	if root.XMLName.Local != "xliff" {
+		return nil, fmt.Errorf("ImportXLIFF() - Not an XLIFF file: root element %s", root.XMLName.Local)
+	}
+
+	x = &XLIFFFile{}
+	switch {
+	case strings.HasPrefix(root.Version, "1."):
+		var doc xliff12
+		if err = xml.Unmarshal(buf, &doc); err != nil {
+			return nil, fmt.Errorf("ImportXLIFF() - %v", err)
+		}
+		x.Version = XLIFF12
+		for i, f := range doc.Files {
+			if i == 0 {
+				x.Original, x.SourceLanguage, x.TargetLanguage = f.Original, f.SourceLanguage, f.TargetLanguage
+			}
+			for _, u := range f.Units {
+				xu := XLIFFUnit{ID: u.ID, Key: u.Resname, Source: u.Source}
+				if u.Target != nil {
+					xu.Target, xu.State = u.Target.Text, u.Target.State
+				}
+				xu.setNotes(u.Notes, func(n xliffNote) string { return n.From })
+				x.Units = append(x.Units, xu)
+			}
+		}
+
+	case strings.HasPrefix(root.Version, "2."):
+		var doc xliff20
+		if err = xml.Unmarshal(buf, &doc); err != nil {
+			return nil, fmt.Errorf("ImportXLIFF() - %v", err)
+		}
+		x.Version = XLIFF20
+		x.SourceLanguage, x.TargetLanguage = doc.SrcLang, doc.TrgLang
+		for i, f := range doc.Files {
+			if i == 0 {
+				x.Original = f.Original
+			}
+			x.add20(f.Units, f.Groups)
+		}
+
+	default:
+		return nil, fmt.Errorf("ImportXLIFF() - Unsupported XLIFF version %q", root.Version)
+	}
+
+	for i := range x.Units {
+		if err = x.Units[i].complete(); err != nil {
+			return nil, fmt.Errorf("ImportXLIFF() - %v", err)
+		}
+	}
+	return x, nil
+}
+
+// add20 adds the units of an XLIFF 2.0 file or group in document order
+func (x *XLIFFFile) add20(units []xliff20Unit, groups []xliff20Group) {
+	for _, u := range units {
+		xu := XLIFFUnit{ID: u.ID, Key: u.Name}
+		for _, s := range u.Segments {
+			xu.Source += s.Source.Text
+			if s.Target != nil {
+				xu.Target += s.Target.Text
+			}
+			if len(xu.State) == 0 {
+				xu.State = s.State
+			}
+		}
+		if u.Notes != nil {
+			xu.setNotes(u.Notes.Notes, func(n xliffNote) string { return n.Category })
+		}
+		x.Units = append(x.Units, xu)
+	}
+	for _, g := range groups {
+		x.add20(g.Units, g.Groups)
+	}
+}
+
+// setNotes reads the notes written by ExportXLIFF()
+func (u *XLIFFUnit) setNotes(notes []xliffNote, kind func(xliffNote) string) {
+	for _, n := range notes {
+		switch kind(n) {
+		case "condition":
+			u.Cond = strings.TrimSpace(n.Text)
+		case "plural-gender":
+			u.PluralGender = true
+		}
+	}
+}
+
+// complete takes the key and conditional statement from the id if missing and flags plural/gender keys
+func (u *XLIFFUnit) complete() error {
+	if len(u.Key) == 0 {
+		key := u.ID
+		if i := strings.LastIndex(key, "["); i > 0 && strings.HasSuffix(key, "]") {
+			key, u.Cond = key[:i], key[i:]
+		}
+		u.Key = key
+	}
+	if len(u.Key) == 0 {
+		return fmt.Errorf("Unit without id nor name")
+	}
+	if len(plrGdrSuffix(u.Key)) > 0 {
+		u.PluralGender = true
+	}
+	return nil
+}
+
+// MergeXLIFF()
+//
+// Set the translations of an XLIFF file in the loc file, whatever their state.
+// Units without target are ignored. Tokens keep their place and new ones are inserted
+// following the order of the XLIFF file. Save() then writes the file in its encoding.
+// Returns the number of token variants added or modified.
+// err != nil if the target language of the XLIFF file isn't the one of the loc file.
+//
+func (v *VDFFile) MergeXLIFF(x *XLIFFFile) (merged int, err error) {
+	v.log(fmt.Sprintf("MergeXLIFF(%s)", x.Original))
+
+	if err = v.checkLanguage(x.TargetLanguage, "XLIFF"); err != nil {
+		return 0, fmt.Errorf("MergeXLIFF() - %v", err)
+	}
+
+	var units []translationUnit
+	for _, u := range x.Units {
+		units = append(units, translationUnit{Key: u.Key, Cond: u.Cond, Source: u.Source, Target: u.Target, Translated: len(u.Target) > 0})
+	}
+	return v.mergeTranslations(units)
+}
@@ -0,0 +1,150 @@
+package vdfloc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Files shared by the tests of the exchange formats (XLIFF, PO, sheets):
+// values with quotes, escape sequences, real tabs and line breaks, markup.
+const exchangeEnglish = "\"lang\"\r\n{\r\n\t\"Language\"\t\"english\"\r\n\t\"Tokens\"\r\n\t{\r\n" +
+	"\t\t\"a\"\t\"He said \\\"yes\\\"\"\t[$WIN32]\t// comment\r\n" +
+	"\t\t\"a\"\t\"Mac\"\t[$OSX]\r\n" +
+	"\t\t\"b\"\t\"Line 1\\nLine 2\\tTab\"\r\n" +
+	"\t\t\"c\"\t\"Real\ttab\r\non two lines\"\r\n" +
+	"\t\t\"d\"\t\"Backslash \\\\ é\"\r\n" +
+	"\t\t\"e\"\t\"<b>Bold</b> & co, \\\"quoted; \\\"\"\r\n" +
+	"\t\t\"f\"\t\"Not translated\"\r\n" +
+	"\t}\r\n}\r\n"
+
+// exchangeFile (jsonimport_test.go) is the french translation, without e and f.
+
+const emptyFrench = "\"lang\"\r\n{\r\n\t\"Language\"\t\"french\"\r\n\t\"Tokens\"\r\n\t{\r\n\t}\r\n}\r\n"
+
+// exchangeFiles returns the english file and its french translation in UTF16LE
+func exchangeFiles(t *testing.T) (en, fr *VDFFile) {
+	t.Helper()
+	en, _ = NewFromBytes([]byte(exchangeEnglish), "x_english.txt")
+	fr, _ = NewFromBytes(encode(t, exchangeFile, "UTF16LE"), "x_french.txt")
+	return en, fr
+}
+
+// decodedTokens returns the values of the tokens of a file (key + cond) with their escape sequences decoded
+func decodedTokens(t *testing.T, v *VDFFile) map[string]string {
+	t.Helper()
+	doc, err := v.tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]string)
+	for _, n := range tokenPairs(doc) {
+		m[n.Key+normalizedCond(n.Cond)], _ = Unescape(n.Value)
+	}
+	return m
+}
+
+// checkMerge merges exported translations in an empty french file and back in the french file:
+// the first one gets the same values, the second one is left untouched
+func checkMerge(t *testing.T, fr *VDFFile, merge func(loc *VDFFile) (int, error)) {
+	t.Helper()
+	checkMergeWant(t, fr, decodedTokens(t, fr), merge)
+}
+
+// checkMergeWant is checkMerge() with the values expected in the empty file
+func checkMergeWant(t *testing.T, fr *VDFFile, want map[string]string, merge func(loc *VDFFile) (int, error)) {
+	t.Helper()
+
+	empty, _ := NewFromBytes(encode(t, emptyFrench, "UTF16LE"), "x_french.txt")
+	merged, err := merge(empty)
+	if err != nil {
+		t.Fatalf("merge in an empty file: %v", err)
+	}
+	if got := decodedTokens(t, empty); merged != len(want) || !equalMaps(got, want) {
+		t.Errorf("merge in an empty file: %d merged, tokens\n%q\nwant\n%q", merged, got, want)
+	}
+	var out bytes.Buffer
+	empty.Write(&out)
+	if !bytes.HasPrefix(out.Bytes(), Utf16LEbom) {
+		t.Errorf("merged file not written in UTF16LE")
+	}
+	reread, _ := NewFromBytes(out.Bytes(), "x_french.txt")
+	if got := decodedTokens(t, reread); !equalMaps(got, want) {
+		t.Errorf("merged file read back:\n%q\nwant\n%q", got, want)
+	}
+
+	var before, after bytes.Buffer
+	fr.Write(&before)
+	if merged, err = merge(fr); err != nil || merged != 0 {
+		t.Errorf("merge in the french file: %d merged, err %v, want 0", merged, err)
+	}
+	fr.Write(&after)
+	if !bytes.Equal(before.Bytes(), after.Bytes()) {
+		t.Errorf("merge in the french file changed it")
+	}
+}
+
+func equalMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestXLIFFRoundTrip(t *testing.T) {
+	for _, version := range []XLIFFVersion{XLIFF12, XLIFF20} {
+		en, fr := exchangeFiles(t)
+		var buf bytes.Buffer
+		if err := ExportXLIFF(en, fr, &buf, version); err != nil {
+			t.Fatalf("%s: ExportXLIFF(): %v", version, err)
+		}
+		x, err := ImportXLIFF(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: ImportXLIFF(): %v", version, err)
+		}
+		if x.Version != version || x.SourceLanguage != "en" || x.TargetLanguage != "fr" || len(x.Units) != 7 {
+			t.Errorf("%s: imported %s %s -> %s, %d units", version, x.Version, x.SourceLanguage, x.TargetLanguage, len(x.Units))
+		}
+		for _, u := range x.Units {
+			if u.Key == "c" && (u.Source != "Real\ttab\r\non two lines" || u.Target != "Vraie\ttabulation\r\nsur deux lignes") {
+				t.Errorf("%s: c = %q -> %q", version, u.Source, u.Target)
+			}
+			if u.Key == "e" && u.Source != "<b>Bold</b> & co, \"quoted; \"" {
+				t.Errorf("%s: e = %q", version, u.Source)
+			}
+		}
+		checkMerge(t, fr, func(loc *VDFFile) (int, error) { return loc.MergeXLIFF(x) })
+	}
+}
+
+func TestXLIFFImportErrors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"<xliff version=\"1.2\"><file><body><trans-unit><source>x</source></trans-unit>",
+		"<xliff version=\"3.0\"></xliff>",
+		"<html></html>",
+	} {
+		if _, err := ImportXLIFF(strings.NewReader(src)); err == nil {
+			t.Errorf("ImportXLIFF(%q): no error", src)
+		}
+	}
+}
+
+func TestXLIFFLanguage(t *testing.T) {
+	for lang, ok := range map[string]bool{"fr": true, "fr-FR": true, "": true, "de-DE": false, "xx": false} {
+		loc, _ := NewFromBytes([]byte(emptyFrench), "x_french.txt")
+		x := &XLIFFFile{SourceLanguage: "en", TargetLanguage: lang, Units: []XLIFFUnit{{Key: "b", Source: "B", Target: "B2"}}}
+		merged, err := loc.MergeXLIFF(x)
+		if ok && (err != nil || merged != 1) {
+			t.Errorf("MergeXLIFF(%s) = %d, %v", lang, merged, err)
+		}
+		if !ok && (err == nil || merged != 0) {
+			t.Errorf("MergeXLIFF(%s) = %d, %v, want an error", lang, merged, err)
+		}
+	}
+}